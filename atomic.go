@@ -0,0 +1,114 @@
+package bloomflt
+
+import (
+	"encoding/binary"
+	"sync/atomic"
+)
+
+// AtomicBloomFilter is a bloom filter that is safe for concurrent use by multiple goroutines without locks.
+//
+// Bits are set with atomic OR operations on the 64-bit words of the bit storage and tested with atomic loads,
+// so neither Add nor Contains methods ever block, unlike the methods of SafeBloomFilter. This makes it a good
+// fit for filters that are read and written by many goroutines at the same time.
+//
+// All atomic operations are sequentially consistent, as guaranteed by the sync/atomic package. Once an Add
+// method returns, all Contains calls that start after it, in any goroutine, report the value as present. A
+// Contains call running at the same time as an Add call of the same value can report it either way. Methods
+// that read all bits, like PopCount and EstimateCount, do not take a snapshot of the filter, so under
+// concurrent Add calls their results can miss some of the bits that were set while they were running.
+type AtomicBloomFilter struct {
+	// inserts is incremented atomically by Add methods, instead of the counter of filter. It is the first field,
+	// so that it is 64-bit aligned for atomic operations on 32-bit platforms.
+	inserts uint64
+	filter  *BloomFilter
+}
+
+// NewAtomicMK creates a new lock-free bloom filter with bucket size equal to m and number of hash functions
+// equal to k.
+func NewAtomicMK(m int, k int) *AtomicBloomFilter {
+	return &AtomicBloomFilter{filter: NewMK(m, k)}
+}
+
+// NewAtomic creates a new lock-free bloom filter with optimal values of m and k for the given acceptable
+// false-positive rate (value from 0.0 to 1.0).
+func NewAtomic(n int, falsePositiveRate float64) *AtomicBloomFilter {
+	return &AtomicBloomFilter{filter: New(n, falsePositiveRate)}
+}
+
+// M returns the size of the bucket (number of bits) used by the filter.
+func (a *AtomicBloomFilter) M() int {
+	return a.filter.m
+}
+
+// K returns the number of hash functions used by the filter.
+func (a *AtomicBloomFilter) K() int {
+	return a.filter.k
+}
+
+// AddBytes inserts a bytes value to the set
+func (a *AtomicBloomFilter) AddBytes(value []byte) {
+	b := a.filter
+	h1, h2 := b.seedHashes(b.hash1(value), b.hash2(value))
+	for h := 0; h < b.k; h++ {
+		b.bucket.setAtomic(kiMiHash(h1, h2, h, b.m))
+	}
+	atomic.AddUint64(&a.inserts, 1)
+}
+
+// AddString inserts a string value to the set
+func (a *AtomicBloomFilter) AddString(value string) {
+	a.AddBytes([]byte(value))
+}
+
+// AddUInt64 inserts an int value to the set
+func (a *AtomicBloomFilter) AddUInt64(value uint64) {
+	scratch := scratchPool.Get().(*[8]byte)
+	defer scratchPool.Put(scratch)
+	binary.LittleEndian.PutUint64(scratch[:8], value)
+	a.AddBytes(scratch[:8])
+}
+
+// ContainsBytes tests if the set contains the given bytes value
+func (a *AtomicBloomFilter) ContainsBytes(value []byte) bool {
+	b := a.filter
+	h1, h2 := b.seedHashes(b.hash1(value), b.hash2(value))
+	for h := 0; h < b.k; h++ {
+		if !b.bucket.testAtomic(kiMiHash(h1, h2, h, b.m)) {
+			return false
+		}
+	}
+	return true
+}
+
+// ContainsString tests if the set contains the given string value
+func (a *AtomicBloomFilter) ContainsString(value string) bool {
+	return a.ContainsBytes([]byte(value))
+}
+
+// ContainsUInt64 tests if the set contains the given int value
+func (a *AtomicBloomFilter) ContainsUInt64(value uint64) bool {
+	scratch := scratchPool.Get().(*[8]byte)
+	defer scratchPool.Put(scratch)
+	binary.LittleEndian.PutUint64(scratch[:8], value)
+	return a.ContainsBytes(scratch[:8])
+}
+
+// PopCount returns the number of bits of the filter that are set. See AtomicBloomFilter on the result under
+// concurrent Add calls.
+func (a *AtomicBloomFilter) PopCount() int {
+	return a.filter.bucket.countAtomic()
+}
+
+// EstimateCount returns an approximation of the number of distinct elements added to the filter, see
+// BloomFilter.EstimateCount. Under concurrent Add calls the result can be slightly lower than the number of
+// elements added when it returns.
+func (a *AtomicBloomFilter) EstimateCount() int {
+	return estimateCount(a.filter.m, a.filter.k, a.PopCount())
+}
+
+// InsertCount returns the exact number of times a value was added to the set since the filter was created, see
+// BloomFilter.InsertCount. The count is incremented atomically after the bits of the value are set, so it
+// includes all Add calls that returned before InsertCount was called.
+func (a *AtomicBloomFilter) InsertCount() uint64 {
+	return atomic.LoadUint64(&a.inserts)
+}
@@ -0,0 +1,69 @@
+package bloomflt
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestAtomicConcurrent(t *testing.T) {
+	a := NewAtomic(10000, 0.01)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				value := fmt.Sprintf("value%d-%d", g, i)
+				a.AddString(value)
+				if !a.ContainsString(value) {
+					t.Errorf("a.ContainsString(%q) = %v, want %v", value, false, true)
+				}
+				a.EstimateCount()
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	for g := 0; g < 8; g++ {
+		for i := 0; i < 1000; i++ {
+			value := fmt.Sprintf("value%d-%d", g, i)
+			ok := a.ContainsString(value)
+			if !ok {
+				t.Errorf("a.ContainsString(%q) = %v, want %v", value, ok, true)
+			}
+		}
+	}
+
+	count := a.EstimateCount()
+	if count < 7600 || count > 8400 {
+		t.Errorf("a.EstimateCount() = %v, want approximately %v", count, 8000)
+	}
+	inserts := a.InsertCount()
+	if inserts != 8000 {
+		t.Errorf("a.InsertCount() = %v, want %v", inserts, 8000)
+	}
+}
+
+func TestAtomicMatchesBloomFilter(t *testing.T) {
+	a := NewAtomicMK(1024, 3)
+	b := NewMK(1024, 3)
+	a.AddString("SomeValue")
+	a.AddUInt64(64)
+	b.AddString("SomeValue")
+	b.AddUInt64(64)
+
+	if !a.filter.Equal(b) {
+		t.Errorf("AtomicBloomFilter did not set the same bits as BloomFilter")
+	}
+	if !a.ContainsUInt64(64) {
+		t.Errorf("a.ContainsUInt64(%v) = %v, want %v", 64, false, true)
+	}
+	if a.ContainsString("AnotherValue") {
+		t.Errorf("a.ContainsString(%q) = %v, want %v", "AnotherValue", true, false)
+	}
+	if a.PopCount() != b.PopCount() {
+		t.Errorf("a.PopCount() = %v, want %v", a.PopCount(), b.PopCount())
+	}
+}
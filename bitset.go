@@ -0,0 +1,111 @@
+package bloomflt
+
+import (
+	"math/bits"
+	"sync/atomic"
+)
+
+// bitset is a fixed size set of bits, stored in 64-bit words. Bit i is stored in word i/64 at position i%64.
+type bitset []uint64
+
+// newBitset creates a bitset large enough to store m bits. All words are allocated upfront, so setting bits
+// never allocates, regardless of their position.
+func newBitset(m int) bitset {
+	if m <= 0 {
+		return bitset{}
+	}
+	return make(bitset, (m-1)/64+1)
+}
+
+// set sets the bit at the given index to 1.
+func (s bitset) set(index int) {
+	s[index>>6] |= 1 << uint(index&63)
+}
+
+// clear sets the bit at the given index to 0.
+func (s bitset) clear(index int) {
+	s[index>>6] &^= 1 << uint(index&63)
+}
+
+// test returns true if the bit at the given index is set.
+func (s bitset) test(index int) bool {
+	return s[index>>6]&(1<<uint(index&63)) != 0
+}
+
+// setAtomic sets the bit at the given index to 1 with an atomic operation, so that it can be called
+// concurrently with setAtomic, testAtomic and countAtomic.
+func (s bitset) setAtomic(index int) {
+	word := &s[index>>6]
+	mask := uint64(1) << uint(index&63)
+	// Skip the write when the bit is already set, so that readers of the word are not slowed down
+	if atomic.LoadUint64(word)&mask == 0 {
+		atomic.OrUint64(word, mask)
+	}
+}
+
+// testAtomic returns true if the bit at the given index is set, reading the word with an atomic operation.
+func (s bitset) testAtomic(index int) bool {
+	return atomic.LoadUint64(&s[index>>6])&(1<<uint(index&63)) != 0
+}
+
+// countAtomic returns the number of bits that are set, reading each word with an atomic operation.
+func (s bitset) countAtomic() int {
+	count := 0
+	for i := range s {
+		count += bits.OnesCount64(atomic.LoadUint64(&s[i]))
+	}
+	return count
+}
+
+// count returns the number of bits that are set.
+func (s bitset) count() int {
+	count := 0
+	for _, word := range s {
+		count += bits.OnesCount64(word)
+	}
+	return count
+}
+
+// forEach calls fn with the index of each set bit in ascending order, until fn returns false.
+func (s bitset) forEach(fn func(index int) bool) {
+	for i, word := range s {
+		for word != 0 {
+			index := i*64 + bits.TrailingZeros64(word)
+			if !fn(index) {
+				return
+			}
+			// Clear the lowest set bit
+			word &= word - 1
+		}
+	}
+}
+
+// reset sets all bits to 0.
+func (s bitset) reset() {
+	for i := range s {
+		s[i] = 0
+	}
+}
+
+// byteAt returns byte i of the bitset, which holds bits 8*i to 8*i+7.
+func (s bitset) byteAt(i int) byte {
+	return byte(s[i/8] >> uint(i%8*8))
+}
+
+// bytes returns the first size bytes of the bitset, where byte i holds bits 8*i to 8*i+7.
+func (s bitset) bytes(size int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = s.byteAt(i)
+	}
+	return data
+}
+
+// bitsetFromBytes creates a bitset of m bits from data in the format returned by bitset.bytes.
+func bitsetFromBytes(m int, data []byte) bitset {
+	s := newBitset(m)
+	for i, value := range data {
+		s[i/8] |= uint64(value) << uint(i%8*8)
+	}
+	return s
+}
@@ -2,11 +2,20 @@
 package bloomflt
 
 import (
+	"bufio"
+	"encoding"
 	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
 	"hash/crc32"
 	"hash/fnv"
+	"io"
 	"math"
-	"math/big"
+	"math/bits"
+	"net"
+	"sync"
+	"time"
 )
 
 // BloomFilter is an efficient data structure, used to test whether an element is a member of a set.
@@ -20,80 +29,601 @@ import (
 // If the bloom filter says an element IS in the set, then that means the element is probably there,
 // but it is not guaranteed.
 //
-// This implementation uses the big.Int type as bitset storage and FNV-1a (Fowler–Noll–Vo) and CRC32
+// This implementation uses a slice of 64-bit words as bitset storage and FNV-1a (Fowler–Noll–Vo) and CRC32
 // from the builtin hash package as the base hash functions. Additional hash functions are simulated
 // with "Double Hashing Scheme" by Kirsch and Mitzenmacher as explained in "Less Hashing, Same Performance:
 // Building a Better Bloom Filter".
+//
+// A nil *BloomFilter is an empty set that can not be changed: the Contains methods report all values as
+// missing, while the Add methods panic with a message about the nil filter. This allows fields holding
+// optional filters to be tested without checking them for nil first.
+//
+// BloomFilter is not safe for concurrent use by multiple goroutines, use SafeBloomFilter for that.
 type BloomFilter struct {
-	m      int      // Number of elements in the set
-	k      int      // Number of hash functions
-	bucket *big.Int // Bit storage
+	m        int                // Number of elements in the set
+	k        int                // Number of hash functions
+	bucket   bitset             // Bit storage
+	newHash1 func() hash.Hash32 // Constructor of the first base hash function, FNV-1a if nil
+	newHash2 func() hash.Hash32 // Constructor of the second base hash function, CRC32 if nil
+	hashers  *hasherPool        // Reusable instances of newHash1 and newHash2, shared with copies of the filter
+	seed     uint64             // Seed mixed into the base hashes, not used if zero
+	domain   []byte             // Domain given to NewWithDomain preceded by its length, hashed before every value
+	order    binary.ByteOrder   // Byte order of encoded int values, little endian if nil
+	setBits  int                // Number of set bits, kept up to date by Add methods, not valid if stale
+	stale    bool               // Set when bits are changed in bulk, until setBits is counted again
+	inserts  uint64             // Number of values added since the filter was created or cleared, see InsertCount
+	retain   bool               // Whether copies of added values are kept in inputs, see RetainInputs
+	inputs   [][]byte           // Copies of the values added since retaining was enabled
+	onFull   func()             // Callback registered with OnSaturation, if any
+	fullAt   float64            // Fill ratio above which onFull is called
+	notified bool               // Whether onFull was called since it was registered or the filter was cleared
+	scratch  [16]byte           // Buffer for encoding of values (up to 16 bytes for complex128) without allocations
 }
 
+// maxBits is the largest number of bits that can be indexed on this platform.
+const maxBits = math.MaxInt
+
+// maxAllocBits is the largest number of bits of the filters created by New and the other constructors that
+// calculate m: 2^32 bits (512 MiB of bit storage) on 64-bit platforms and maxBits on 32-bit platforms. Larger
+// values of m can be indexed, but could not be allocated on most machines, so optimal values above it are
+// clamped to it. Filters with more bits can still be created with NewMK.
+const maxAllocBits = min(1<<32, maxBits)
+
 // NewMK creates a new bloom filter with bucket size equal to m and number of hash functions equal to k.
+// Values of m less than 1 are replaced with 1.
 func NewMK(m int, k int) *BloomFilter {
-	filter := BloomFilter{m, k, big.NewInt(0)}
+	// Use at least one bit, as kiMiHash needs at least one index to map hashes to
+	if m < 1 {
+		m = 1
+	}
+	filter := BloomFilter{m: m, k: k, bucket: newBitset(m)}
 
 	return &filter
 }
 
+// NewWithHashes creates a new bloom filter with bucket size equal to m and number of hash functions equal to k,
+// which uses the hash functions created by h1 and h2 as base hash functions, instead of FNV-1a and CRC32.
+// The created hash functions are reused for many values, after resetting them with their Reset method.
+func NewWithHashes(m int, k int, h1 func() hash.Hash32, h2 func() hash.Hash32) *BloomFilter {
+	filter := NewMK(m, k)
+	filter.newHash1 = h1
+	filter.newHash2 = h2
+	filter.hashers = newHasherPool(h1, h2)
+
+	return filter
+}
+
+// hasherPool holds instances of the hash functions given to NewWithHashes, so that they are not created, and
+// allocated, for every added or tested value. Pooled hash functions can be in any state and must be reset before
+// they are used. The pool is safe for concurrent use, e.g. by Contains methods of SafeBloomFilter.
+type hasherPool struct {
+	first  sync.Pool
+	second sync.Pool
+}
+
+// newHasherPool creates a pool for the hash functions created by h1 and h2, which can be nil.
+func newHasherPool(h1 func() hash.Hash32, h2 func() hash.Hash32) *hasherPool {
+	p := &hasherPool{}
+	if h1 != nil {
+		p.first.New = func() interface{} {
+			return h1()
+		}
+	}
+	if h2 != nil {
+		p.second.New = func() interface{} {
+			return h2()
+		}
+	}
+	return p
+}
+
+// sum returns the hash of domain followed by value, calculated with a hash function from pool.
+func (p *hasherPool) sum(pool *sync.Pool, domain []byte, value []byte) uint32 {
+	f := pool.Get().(hash.Hash32)
+	f.Reset()
+	f.Write(domain)
+	f.Write(value)
+	hash := f.Sum32()
+	pool.Put(f)
+	return hash
+}
+
+// NewFNV creates a new bloom filter with bucket size equal to m and number of hash functions equal to k,
+// which uses FNV-1a and FNV-1 as base hash functions, instead of FNV-1a and CRC32. It is the same as calling
+// NewWithHashes with fnv.New32a and fnv.New32, for inputs on which CRC32 does not perform well.
+func NewFNV(m int, k int) *BloomFilter {
+	return NewWithHashes(m, k, fnv.New32a, fnv.New32)
+}
+
+// NewSeeded creates a new bloom filter with bucket size equal to m and number of hash functions equal to k,
+// which mixes the given seed into the base hashes of every value. Filters created with the same seed (and
+// the same m and k) set the same bits for the same values on every run and machine, while filters with
+// different seeds set different bits. A seed of zero creates the same filter as NewMK.
+func NewSeeded(m int, k int, seed uint64) *BloomFilter {
+	filter := NewMK(m, k)
+	filter.seed = seed
+
+	return filter
+}
+
+// NewWithByteOrder creates a new bloom filter with bucket size equal to m and number of hash functions equal
+// to k, which encodes int values in the given byte order, instead of little endian. This affects all methods
+// that encode numbers before hashing them, like AddUInt32, AddInt, AddFloat64 or AddTime.
+//
+// Filters set the same bits for the same int values only if they use the same byte order, so this is needed
+// to interoperate with systems that encode ints as big endian (binary.BigEndian) before hashing them.
+func NewWithByteOrder(m int, k int, order binary.ByteOrder) *BloomFilter {
+	filter := NewMK(m, k)
+	filter.order = order
+
+	return filter
+}
+
+// NewWithDomain creates a new bloom filter with bucket size equal to m and number of hash functions equal to k,
+// which hashes the given domain before every value, so that filters used for different purposes (e.g. one per
+// tenant) set different bits for the same values. A domain that is nil or empty creates the same filter as NewMK.
+//
+// Unlike with NewSeeded, where the seed is mixed into the hashes of the value, the domain is part of the hashed
+// data: values that collide in the base hashes of a filter with one domain do not collide in a filter with another
+// domain, so collisions found by probing one filter can not be reused against other filters. The domain is
+// preceded by its length, encoded like the fields in AddFields, so no pair of domain and value hashes the same as
+// another pair. HashOnly returns hashes that include the domain, while hashes passed directly to AddHashed and
+// ContainsHashed are used as they are.
+func NewWithDomain(m int, k int, domain []byte) *BloomFilter {
+	filter := NewMK(m, k)
+	if len(domain) > 0 {
+		n := binary.PutUvarint(filter.scratch[:], uint64(len(domain)))
+		filter.domain = append(append([]byte(nil), filter.scratch[:n]...), domain...)
+	}
+
+	return filter
+}
+
 // CalcOptimalMK calculates optimal values of m and k for the specified number of elements in the set (n),
 // and given acceptable false-positive rate (value from 0.0 to 1.0).
 func CalcOptimalMK(n int, falsePositiveRate float64) (int, int) {
+	m, k := optimalMK(n, falsePositiveRate)
+	return int(m + 0.5), int(k + 0.5)
+}
+
+// optimalMK returns the unrounded optimal values of m and k.
+func optimalMK(n int, falsePositiveRate float64) (float64, float64) {
 	m := -1 * float64(n) * math.Log(falsePositiveRate) / math.Pow(math.Log(2), 2)
 	k := m / float64(n) * math.Log(2)
-	return int(m + 0.5), int(k + 0.5)
+	return m, k
+}
+
+// OptimalK returns the unrounded number of hash functions that minimizes the false-positive rate of a filter
+// with m bits after adding n elements to it, calculated as (m/n) * ln(2). The number of hash functions of a
+// filter must be a whole number, so comparing this value with the rounded one used by CalcOptimalMK or New
+// shows how far from the optimum the filter is. Zero is returned if m or n is less than 1.
+func OptimalK(m int, n int) float64 {
+	if m < 1 || n < 1 {
+		return 0
+	}
+	return float64(m) / float64(n) * math.Ln2
 }
 
 // New creates a new bloom filter with optimal values of m and k for the given given acceptable false-positive
 // rate (value from 0.0 to 1.0).
+//
+// Values of m and k that can not be used are silently adjusted: m is limited to the range from 1 to 2^32 bits
+// (512 MiB of bit storage) on 64-bit platforms, or to the largest value of int on 32-bit platforms, and k is
+// at least 1. Use NewClamped to find out if that happened, or NewValidated to get an error instead.
 func New(n int, falsePositiveRate float64) *BloomFilter {
-	m, k := CalcOptimalMK(n, falsePositiveRate)
+	return NewMK(usableMK(n, falsePositiveRate))
+}
+
+// NewClamped creates a new bloom filter like New does, and also reports if the optimal values of m and k had
+// to be adjusted to usable ones. When clamped is true because of a very large number of elements or a very
+// low rate, m is limited to the same maximum as in New, and the false-positive rate of the filter is worse
+// than requested.
+func NewClamped(n int, falsePositiveRate float64) (filter *BloomFilter, clamped bool) {
+	m, k, clamped := clampedMK(n, falsePositiveRate)
+	return NewMK(m, k), clamped
+}
+
+// NewBitsPerElement creates a new bloom filter for the specified number of elements in the set (n), with
+// the given number of bits per element, instead of a false-positive rate. The filter has m = n * bitsPerElement
+// bits and k = ln(2) * m/n hash functions, rounded to the nearest integer. As a rule of thumb, 10 bits per
+// element give a false-positive rate of about 1% and every additional 4.8 bits reduce it ten times.
+//
+// Like with New, m is limited to the range from 1 to 2^32 bits (or the largest value of int on 32-bit
+// platforms) and k is at least 1.
+func NewBitsPerElement(n int, bitsPerElement float64) *BloomFilter {
+	optM := float64(n) * bitsPerElement
+	m := maxAllocBits
+	if optM < maxAllocBits {
+		m = int(optM + 0.5)
+	}
+	k := int(math.Ln2*bitsPerElement + 0.5)
+	if k < 1 {
+		k = 1
+	}
+	return NewMK(m, k)
+}
+
+// NewFixedM creates a new bloom filter with bucket size equal to m, e.g. when m is limited by a memory budget,
+// and the number of hash functions that gives the lowest false-positive rate for the specified number of elements
+// in the set (n): k = ln(2) * m/n, rounded to the nearest integer (see OptimalK). Like with NewMK, values of m
+// less than 1 are replaced with 1, and k is at least 1.
+func NewFixedM(m int, n int) *BloomFilter {
+	k := int(OptimalK(m, n) + 0.5)
+	if k < 1 {
+		k = 1
+	}
+	return NewMK(m, k)
+}
+
+// NewValidated creates a new bloom filter with optimal values of m and k for the given acceptable false-positive
+// rate, like New does. Unlike New, it returns an error instead of adjusting the values of m and k when n is
+// negative, the rate is not between 0.0 and 1.0 (exclusive), or the computed values of m and k are unusable.
+// See CalcOptimalMKChecked for the returned errors.
+func NewValidated(n int, falsePositiveRate float64) (*BloomFilter, error) {
+	m, k, err := CalcOptimalMKChecked(n, falsePositiveRate)
+	if err != nil {
+		return nil, err
+	}
+	return NewMK(m, k), nil
+}
+
+// ErrInvalidParams is returned by CalcOptimalMKChecked and NewValidated, when the number of elements or the
+// false-positive rate can not be used to calculate the parameters of a filter. Use errors.Is to test for it,
+// as it is returned wrapped with the reason.
+var ErrInvalidParams = errors.New("bloomflt: invalid filter parameters")
+
+// CalcOptimalMKChecked calculates optimal values of m and k like CalcOptimalMK does, but returns an error
+// wrapping ErrInvalidParams instead of meaningless values when n is negative, the rate is not between 0.0 and
+// 1.0 (exclusive), or the computed values of m and k are unusable: m more than the maximum used by New (2^32 bits
+// on 64-bit platforms, see New), or m or k less than 1 (e.g. for zero elements or a rate close to 1.0).
+func CalcOptimalMKChecked(n int, falsePositiveRate float64) (int, int, error) {
+	if n < 0 {
+		return 0, 0, fmt.Errorf("%w: invalid number of elements %d", ErrInvalidParams, n)
+	}
+	if !(falsePositiveRate > 0 && falsePositiveRate < 1) {
+		return 0, 0, fmt.Errorf("%w: false-positive rate %v is not between 0 and 1", ErrInvalidParams, falsePositiveRate)
+	}
+
+	optM, optK := optimalMK(n, falsePositiveRate)
+	if !(optM < maxAllocBits+0.5) {
+		return 0, 0, fmt.Errorf("%w: %v bits needed for %d elements exceed the maximum of %d", ErrInvalidParams, optM, n,
+			maxAllocBits)
+	}
+	m, k := int(optM+0.5), int(optK+0.5)
+	if m < 1 {
+		return 0, 0, fmt.Errorf("%w: %d elements need less than one bit", ErrInvalidParams, n)
+	}
+	if k < 1 {
+		return 0, 0, fmt.Errorf("%w: false-positive rate %v needs less than one hash function", ErrInvalidParams,
+			falsePositiveRate)
+	}
+	return m, k, nil
+}
+
+// usableMK returns the optimal values of m and k for n and falsePositiveRate, limited to values that
+// can be used to create a filter.
+func usableMK(n int, falsePositiveRate float64) (int, int) {
+	m, k, _ := clampedMK(n, falsePositiveRate)
+	return m, k
+}
+
+// clampedMK returns the same values as usableMK and true if they differ from the rounded optimal values.
+func clampedMK(n int, falsePositiveRate float64) (int, int, bool) {
+	optM, optK := optimalMK(n, falsePositiveRate)
+	clamped := false
+	// Limit the number of bits to a size that can be allocated
+	m := maxAllocBits
+	if optM < maxAllocBits {
+		m = int(optM + 0.5)
+	} else {
+		clamped = true
+	}
+	k := int(optK + 0.5)
 	// Use at least one bit
 	if m < 1 {
 		m = 1
-	}
-	// Limit the number of bits to 2^31
-	if m > math.MaxInt32 {
-		m = math.MaxInt32
+		clamped = true
 	}
 	// Use at least one hash function
 	if k < 1 {
 		k = 1
+		clamped = true
 	}
-	return NewMK(m, k)
+	return m, k, clamped
 }
 
-// FNV-1a (Fowler–Noll–Vo) is used as the first hash function in kiMiHash
+// M returns the size of the bucket (number of bits) used by the filter.
+func (b *BloomFilter) M() int {
+	return b.m
+}
+
+// K returns the number of hash functions used by the filter.
+func (b *BloomFilter) K() int {
+	return b.k
+}
+
+// byteOrder returns the byte order used to encode int values.
+func (b *BloomFilter) byteOrder() binary.ByteOrder {
+	if b.order == nil {
+		return binary.LittleEndian
+	}
+	return b.order
+}
+
+// domainName returns the domain given to NewWithDomain, without the length that precedes it in b.domain.
+func (b *BloomFilter) domainName() []byte {
+	_, n := binary.Uvarint(b.domain)
+	return b.domain[n:]
+}
+
+// hash1 returns the first base hash used in kiMiHash, FNV-1a unless another one was given to NewWithHashes
 func (b *BloomFilter) hash1(value []byte) uint32 {
-	f := fnv.New32a()
-	f.Write(value)
-	hash := f.Sum32()
-	return hash
+	if b.newHash1 != nil {
+		return b.hashers.sum(&b.hashers.first, b.domain, value)
+	}
+	if b.domain != nil {
+		f := fnv.New32a()
+		f.Write(b.domain)
+		f.Write(value)
+		return f.Sum32()
+	}
+	return fnvHash(value)
 }
 
-// CRC32 is used as the second hash function in kiMiHash
+// hash2 returns the second base hash used in kiMiHash, CRC32 unless another one was given to NewWithHashes
 func (b *BloomFilter) hash2(value []byte) uint32 {
-	f := crc32.NewIEEE()
+	if b.newHash2 != nil {
+		return b.hashers.sum(&b.hashers.second, b.domain, value)
+	}
+	if b.domain != nil {
+		return crc32.Update(crc32.Update(0, crc32.IEEETable, b.domain), crc32.IEEETable, value)
+	}
+	return crcHash(value)
+}
+
+// FNV-1a (Fowler–Noll–Vo) is used as the default first hash function in kiMiHash. The hasher does not escape
+// to the heap, so creating it for every value does not allocate and it is not pooled like the hash functions
+// given to NewWithHashes.
+func fnvHash(value []byte) uint32 {
+	f := fnv.New32a()
 	f.Write(value)
 	hash := f.Sum32()
 	return hash
 }
 
+// CRC32 is used as the default second hash function in kiMiHash. The checksum is calculated directly with the
+// precomputed IEEE table, which is faster than writing the value to a new hash.Hash32 and reading its sum.
+func crcHash(value []byte) uint32 {
+	return crc32.Update(0, crc32.IEEETable, value)
+}
+
+// newHashers returns new instances of the two base hash functions, for hashing of values that are
+// written in parts. The domain of the filter is already written to them.
+func (b *BloomFilter) newHashers() (hash.Hash32, hash.Hash32) {
+	var f1, f2 hash.Hash32
+	if b.newHash1 != nil {
+		f1 = b.newHash1()
+	} else {
+		f1 = fnv.New32a()
+	}
+	if b.newHash2 != nil {
+		f2 = b.newHash2()
+	} else {
+		f2 = crc32.NewIEEE()
+	}
+	f1.Write(b.domain)
+	f2.Write(b.domain)
+	return f1, f2
+}
+
+// hashReader returns the two base hashes of all data read from r until io.EOF
+func (b *BloomFilter) hashReader(r io.Reader) (uint32, uint32, error) {
+	f1, f2 := b.newHashers()
+	_, err := io.Copy(io.MultiWriter(f1, f2), r)
+	if err != nil {
+		return 0, 0, err
+	}
+	return f1.Sum32(), f2.Sum32(), nil
+}
+
+// hashFields returns the two base hashes of the given fields, each preceded by its length as uvarint
+func (b *BloomFilter) hashFields(fields [][]byte) (uint32, uint32) {
+	if b.newHash1 == nil && b.newHash2 == nil {
+		// The default hashers do not escape to the heap when they are created in the same function
+		f1, f2 := fnv.New32a(), crc32.NewIEEE()
+		f1.Write(b.domain)
+		f2.Write(b.domain)
+		for _, field := range fields {
+			n := binary.PutUvarint(b.scratch[:], uint64(len(field)))
+			f1.Write(b.scratch[:n])
+			f2.Write(b.scratch[:n])
+			f1.Write(field)
+			f2.Write(field)
+		}
+		return f1.Sum32(), f2.Sum32()
+	}
+
+	f1, f2 := b.newHashers()
+	for _, field := range fields {
+		n := binary.PutUvarint(b.scratch[:], uint64(len(field)))
+		f1.Write(b.scratch[:n])
+		f2.Write(b.scratch[:n])
+		f1.Write(field)
+		f2.Write(field)
+	}
+	return f1.Sum32(), f2.Sum32()
+}
+
+// seedHashes mixes the seed of the filter into the base hashes h1 and h2. Each half of the mixed seed is
+// XOR-ed into one of the hashes, followed by the MurmurHash3 finalizer, so that the seed affects all bits.
+func (b *BloomFilter) seedHashes(h1 uint32, h2 uint32) (uint32, uint32) {
+	if b.seed == 0 {
+		return h1, h2
+	}
+	seed := mix64(b.seed)
+	return mix32(h1 ^ uint32(seed)), mix32(h2 ^ uint32(seed>>32))
+}
+
 // kiMiHash simulates arbitrary number of hash functions with a "Double Hashing Scheme" by using only
 // two hash functions (5.2. in "Less Hashing, Same Performance: Building a Better Bloom Filter" by Kirsch
 // and Mitzenmacher). Simplified explanation at:
 // http://willwhim.wpengine.com/2011/09/03/producing-n-hash-functions-by-hashing-only-once/
-func (b *BloomFilter) kiMiHash(value []byte, hashIdx int) int {
-	index := (b.hash1(value) + b.hash2(value)*uint32(hashIdx)) % uint32(b.m)
+//
+// The "enhanced double hashing" variant g(i) = h1 + i*h2 + (i^3-i)/6 is used, as described in "Bloom Filters
+// in Probabilistic Verification" by Dillinger and Manolios. The cubic term decorrelates the generated indices,
+// which with plain double hashing can repeat or follow each other for some values of h2.
+//
+// The base hashes h1 and h2 should be calculated once per value and reused for all values of hashIdx.
+// The returned index is in the range [0, m).
+//
+// The combined hash is mapped to the range [0, m) with Lemire's multiply-shift reduction instead of modulo.
+// When m is not a power of two, some indices can be produced by one more hash value than others. Modulo
+// gives all those indices to the beginning of the range, while the multiply-shift reduction spreads them
+// evenly over the whole range.
+func kiMiHash(h1 uint32, h2 uint32, hashIdx int, m int) int {
+	if uint64(m) > math.MaxUint32 {
+		return kiMiHash64(h1, h2, hashIdx, m)
+	}
+	i := uint32(hashIdx)
+	hash := h1 + h2*i + (i*i*i-i)/6
+	index := uint64(hash) * uint64(m) >> 32
 	return int(index)
 }
 
+// kiMiHash64 is used by kiMiHash for filters with more than 2^32 bits, which can not be addressed with
+// 32-bit hashes. The two base hashes are widened to 64 bits - the first one by joining h1 and h2 and the
+// second one by mixing the first one with the SplitMix64 finalizer - and combined with 64-bit arithmetic.
+func kiMiHash64(h1 uint32, h2 uint32, hashIdx int, m int) int {
+	x1 := uint64(h1)<<32 | uint64(h2)
+	x2 := mix64(x1)
+	i := uint64(hashIdx)
+	index, _ := bits.Mul64(x1+x2*i+(i*i*i-i)/6, uint64(m))
+	return int(index)
+}
+
+// mix32 is the finalizer of MurmurHash3, which spreads the bits of x over the whole result.
+func mix32(x uint32) uint32 {
+	x ^= x >> 16
+	x *= 0x85ebca6b
+	x ^= x >> 13
+	x *= 0xc2b2ae35
+	return x ^ (x >> 16)
+}
+
+// mix64 is the finalizer of the SplitMix64 generator, which spreads the bits of x over the whole result.
+func mix64(x uint64) uint64 {
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
 // AddBytes inserts a bytes value to the set
 func (b *BloomFilter) AddBytes(value []byte) {
+	b.checkNotNil()
+	b.retainInput(value)
+	b.addHashed(b.hash1(value), b.hash2(value))
+}
+
+// AddHashed inserts a value to the set, given its two base hashes instead of the value itself. This skips
+// hashing of the value, for callers that already have good quality hashes of their values, e.g. to reuse them
+// across several data structures.
+//
+// The hashes are used in place of the FNV-1a and CRC32 hashes (or the hash functions given to NewWithHashes),
+// so the false-positive rate of the filter depends directly on their quality. Both hashes should be uniformly
+// distributed and independent from each other. The seed given to NewSeeded is still mixed into them.
+//
+// The value itself is not known, so it can not be retained for GrowTo (see RetainInputs).
+func (b *BloomFilter) AddHashed(h1 uint32, h2 uint32) {
+	b.checkNotNil()
+	b.forgetInputs()
+	b.addHashed(h1, h2)
+}
+
+// addHashed sets the bits of a value given its two base hashes, without retaining the value.
+func (b *BloomFilter) addHashed(h1 uint32, h2 uint32) {
+	h1, h2 = b.seedHashes(h1, h2)
+	for h := 0; h < b.k; h++ {
+		index := kiMiHash(h1, h2, h, b.m)
+		b.checkIndex(index)
+		if !b.bucket.test(index) {
+			b.bucket.set(index)
+			b.setBits++
+		}
+	}
+	b.inserts++
+	if b.onFull != nil {
+		b.checkSaturation()
+	}
+}
+
+// AddIfNotPresent inserts a bytes value to the set and reports if it was newly added. It returns false if
+// the value was probably already in the set, i.e. if all of its bits were already set, in which case the
+// filter is not changed. Testing and setting the bits is done in a single pass over the hash indices.
+func (b *BloomFilter) AddIfNotPresent(value []byte) bool {
+	b.checkNotNil()
+	// The value can be a false positive, so it is retained even if it is reported as present
+	b.retainInput(value)
+	h1, h2 := b.seedHashes(b.hash1(value), b.hash2(value))
+	added := false
 	for h := 0; h < b.k; h++ {
-		index := b.kiMiHash(value, h)
-		b.bucket.SetBit(b.bucket, index, 1)
+		index := kiMiHash(h1, h2, h, b.m)
+		b.checkIndex(index)
+		if !b.bucket.test(index) {
+			b.bucket.set(index)
+			b.setBits++
+			added = true
+		}
+	}
+	b.inserts++
+	if b.onFull != nil {
+		b.checkSaturation()
+	}
+	return added
+}
+
+// AddBytesChecked inserts a bytes value to the set and reports if the filter is saturated afterwards, i.e.
+// if more than half of its bits are set. That is the fill ratio of a filter with optimal k after adding
+// the number of elements it was designed for, so beyond that the false-positive rate is worse than planned.
+//
+// The number of set bits is tracked by the Add methods, so unlike FillRatio this does not count the bits
+// on every call. It is only counted again after the bits were changed in bulk, e.g. by Union.
+func (b *BloomFilter) AddBytesChecked(value []byte) (saturated bool) {
+	b.AddBytes(value)
+	if b.stale {
+		b.setBits = b.bucket.count()
+		b.stale = false
+	}
+	return b.setBits > b.m/2
+}
+
+// OnSaturation registers fn to be called when the fill ratio of the filter (see FillRatio) exceeds the given
+// threshold, e.g. to replace the filter with a larger one. The fill ratio is checked after each added value,
+// and fn is called from the Add method that made it exceed the threshold, at most once until the filter is
+// cleared with Clear or resized. If the fill ratio already exceeds the threshold, fn is called after the next
+// added value.
+//
+// A filter with optimal k has half of its bits set after adding the number of elements it was designed for,
+// so a threshold of 0.5 reports that the false-positive rate is about to get worse than planned. Only one
+// function can be registered, calling OnSaturation again replaces it, and a nil fn removes it.
+func (b *BloomFilter) OnSaturation(threshold float64, fn func()) {
+	b.onFull = fn
+	b.fullAt = threshold
+	b.notified = false
+}
+
+// checkSaturation calls the function registered with OnSaturation, if the threshold is exceeded for the
+// first time.
+func (b *BloomFilter) checkSaturation() {
+	if b.notified {
+		return
+	}
+	if b.stale {
+		b.setBits = b.bucket.count()
+		b.stale = false
+	}
+	if fillRatio(b.m, b.setBits) > b.fullAt {
+		b.notified = true
+		b.onFull()
 	}
 }
 
@@ -102,30 +632,306 @@ func (b *BloomFilter) AddString(value string) {
 	b.AddBytes([]byte(value))
 }
 
+// AddByteSlices inserts all given bytes values to the set
+func (b *BloomFilter) AddByteSlices(values ...[]byte) {
+	for _, value := range values {
+		b.AddBytes(value)
+	}
+}
+
+// AddStrings inserts all given string values to the set
+func (b *BloomFilter) AddStrings(values ...string) {
+	for _, value := range values {
+		b.AddString(value)
+	}
+}
+
+// AddByte inserts a byte value to the set, encoded as a single byte
+func (b *BloomFilter) AddByte(value byte) {
+	b.checkNotNil()
+	bytes := b.scratch[:1]
+	bytes[0] = value
+	b.AddBytes(bytes)
+}
+
+// AddUInt16 inserts an int value to the set, encoded as 2 bytes
+func (b *BloomFilter) AddUInt16(value uint16) {
+	b.checkNotNil()
+	bytes := b.scratch[:2]
+	b.byteOrder().PutUint16(bytes, value)
+	b.AddBytes(bytes)
+}
+
 // AddUInt32 inserts an int value to the set
 func (b *BloomFilter) AddUInt32(value uint32) {
-	bytes := make([]byte, 4, 4)
-	binary.LittleEndian.PutUint32(bytes, value)
+	b.checkNotNil()
+	bytes := b.scratch[:4]
+	b.byteOrder().PutUint32(bytes, value)
 	b.AddBytes(bytes)
 }
 
 // AddUInt64 inserts an int value to the set
 func (b *BloomFilter) AddUInt64(value uint64) {
-	bytes := make([]byte, 8, 8)
-	binary.LittleEndian.PutUint64(bytes, value)
+	b.checkNotNil()
+	bytes := b.scratch[:8]
+	b.byteOrder().PutUint64(bytes, value)
+	b.AddBytes(bytes)
+}
+
+// AddUvarint inserts an int value to the set, encoded as a varint with binary.PutUvarint (1 to 10 bytes
+// depending on the value), to match values that are stored in that encoding elsewhere. Values added with
+// AddUvarint are not the same elements as values added with AddUInt64.
+func (b *BloomFilter) AddUvarint(value uint64) {
+	b.checkNotNil()
+	n := binary.PutUvarint(b.scratch[:], value)
+	b.AddBytes(b.scratch[:n])
+}
+
+// AddInt inserts an int value to the set. The value is always encoded as 8 bytes, so that it can be
+// found on both 32-bit and 64-bit platforms.
+func (b *BloomFilter) AddInt(value int) {
+	b.AddUInt64(uint64(int64(value)))
+}
+
+// AddFloat64 inserts a float value to the set. The value is encoded with math.Float64bits, so values are
+// compared by their bit pattern: NaN values can be found only if they have the same bit pattern, and +0.0
+// and -0.0 are treated as different values.
+func (b *BloomFilter) AddFloat64(value float64) {
+	b.AddUInt64(math.Float64bits(value))
+}
+
+// AddComplex128 inserts a complex value to the set, encoded as 16 bytes: the real part followed by the imaginary
+// part, each encoded with math.Float64bits like in AddFloat64. Values are compared by the bit patterns of both
+// parts, so like with AddFloat64, NaN parts match only if they have the same bit pattern, and +0.0 and -0.0 are
+// treated as different values (e.g. complex(0, 0) and complex(0, math.Copysign(0, -1)) are different elements).
+func (b *BloomFilter) AddComplex128(value complex128) {
+	b.checkNotNil()
+	b.AddBytes(b.encodeComplex128(value))
+}
+
+// encodeComplex128 encodes value into the scratch buffer of b and returns the encoded bytes.
+func (b *BloomFilter) encodeComplex128(value complex128) []byte {
+	bytes := b.scratch[:16]
+	b.byteOrder().PutUint64(bytes, math.Float64bits(real(value)))
+	b.byteOrder().PutUint64(bytes[8:], math.Float64bits(imag(value)))
+	return bytes
+}
+
+// AddRune inserts a Unicode code point to the set, encoded as 4 bytes like an int32 value, regardless of
+// the length of its UTF-8 encoding.
+func (b *BloomFilter) AddRune(r rune) {
+	b.AddUInt32(uint32(r))
+}
+
+// AddIP inserts an IP address to the set. The address is normalized to its 16-byte form with ip.To16 before
+// hashing, so an IPv4 address and the same address mapped to IPv6 are the same element: adding 1.2.3.4 and
+// testing for ::ffff:1.2.3.4 (or the other way around) reports it as present. Invalid addresses, for which
+// To16 returns nil, are added as they are.
+func (b *BloomFilter) AddIP(ip net.IP) {
+	b.AddBytes(normalizeIP(ip))
+}
+
+// normalizeIP returns the 16-byte form of ip, or ip itself if it is not a valid address.
+func normalizeIP(ip net.IP) []byte {
+	if ip16 := ip.To16(); ip16 != nil {
+		return ip16
+	}
+	return ip
+}
+
+// AddFields inserts a value made of several fields to the set, e.g. a composite key, without concatenating
+// the fields first.
+//
+// A plain concatenation would make e.g. the fields "ab", "c" and "a", "bc" the same element, and a separator
+// byte could also appear within the fields. Instead, each field is preceded by its length encoded as uvarint
+// (see binary.PutUvarint), so the element is the same as if AddBytes was called with the concatenation of
+// uvarint(len(field)) and field for all fields in order.
+func (b *BloomFilter) AddFields(fields ...[]byte) {
+	b.checkNotNil()
+	if b.retain {
+		var value []byte
+		for _, field := range fields {
+			value = append(binary.AppendUvarint(value, uint64(len(field))), field...)
+		}
+		b.inputs = append(b.inputs, value)
+	}
+	b.addHashed(b.hashFields(fields))
+}
+
+// AddReader inserts all data read from r until io.EOF to the set as a single value, without buffering it
+// in memory. The value is the same as if all data was given to AddBytes. Errors returned by r are passed
+// to the caller and nothing is added to the set.
+//
+// The data is not buffered, so it can not be retained for GrowTo (see RetainInputs).
+func (b *BloomFilter) AddReader(r io.Reader) error {
+	b.checkNotNil()
+	h1, h2, err := b.hashReader(r)
+	if err != nil {
+		return err
+	}
+	b.AddHashed(h1, h2)
+	return nil
+}
+
+// maxLineLength is the length of the longest line that AddLines can add to the set.
+const maxLineLength = 1024 * 1024
+
+// AddLines inserts each line read from r until io.EOF to the set as a separate value and returns the number of
+// added lines, e.g. to load a word list or a deny list.
+//
+// Lines are split with bufio.ScanLines: the line ending ("\n" or "\r\n") is removed, while other whitespace
+// is kept, so lookups must use the same line without its line ending to match. The last line is added even if it
+// does not end with a newline, and empty lines are added as empty values. Lines longer than 1 MiB can not be
+// added and an error is returned for them. Lines added before an error remain in the set.
+func (b *BloomFilter) AddLines(r io.Reader) (int, error) {
+	b.checkNotNil()
+	scanner := bufio.NewScanner(r)
+	// The buffer also has to hold the line terminator, which can be "\r\n"
+	scanner.Buffer(nil, maxLineLength+2)
+	n := 0
+	for scanner.Scan() {
+		if len(scanner.Bytes()) > maxLineLength {
+			return n, fmt.Errorf("bloomflt: line %d is longer than %d bytes", n+1, maxLineLength)
+		}
+		b.AddBytes(scanner.Bytes())
+		n++
+	}
+	err := scanner.Err()
+	if err == bufio.ErrTooLong {
+		return n, fmt.Errorf("bloomflt: line %d is longer than %d bytes", n+1, maxLineLength)
+	}
+	return n, err
+}
+
+// AddTime inserts a time value to the set, encoded as 8 bytes with the number of nanoseconds since
+// the Unix epoch (t.UnixNano).
+//
+// Only the instant matters, so the location and the monotonic clock reading of t are ignored. The time
+// must however match to the nanosecond, so times that lose precision elsewhere (e.g. when stored in a
+// database) should be rounded with t.Round or t.Truncate both before adding and before testing them.
+// Times outside of the range of UnixNano (years 1678 to 2262) can not be told apart.
+func (b *BloomFilter) AddTime(t time.Time) {
+	b.AddUInt64(uint64(t.UnixNano()))
+}
+
+// AddMarshaler inserts the binary form of the given value to the set, as returned by its MarshalBinary
+// method. Errors returned by MarshalBinary are passed to the caller and nothing is added to the set.
+func (b *BloomFilter) AddMarshaler(value encoding.BinaryMarshaler) error {
+	bytes, err := value.MarshalBinary()
+	if err != nil {
+		return err
+	}
 	b.AddBytes(bytes)
+	return nil
 }
 
 // ContainsBytes tests if the set contains the given bytes value
 func (b *BloomFilter) ContainsBytes(value []byte) bool {
-	res := true
+	if b == nil {
+		return false
+	}
+	return b.ContainsHashed(b.hash1(value), b.hash2(value))
+}
+
+// ContainsHashed tests if the set contains a value, given its two base hashes instead of the value itself.
+// See AddHashed for details.
+func (b *BloomFilter) ContainsHashed(h1 uint32, h2 uint32) bool {
+	if b == nil {
+		return false
+	}
+	h1, h2 = b.seedHashes(h1, h2)
 	for h := 0; h < b.k; h++ {
-		index := b.kiMiHash(value, h)
-		if b.bucket.Bit(index) == 0 {
-			res = false
+		index := kiMiHash(h1, h2, h, b.m)
+		b.checkIndex(index)
+		if !b.bucket.test(index) {
+			return false
 		}
 	}
-	return res
+	return true
+}
+
+// ContainsBytesK tests if the set contains the given bytes value, like ContainsBytes does, but tests only the
+// bits of the first k hash functions, e.g. to study how the false-positive rate and the speed of lookups change
+// with the number of tested bits. Testing fewer bits can only add false positives, never false negatives.
+// It panics if k is not from 1 to the number of hash functions of the filter.
+func (b *BloomFilter) ContainsBytesK(value []byte, k int) bool {
+	if b == nil {
+		return false
+	}
+	if k < 1 || k > b.k {
+		panic(fmt.Sprintf("bloomflt: number of hash functions %d out of range [1, %d]", k, b.k))
+	}
+	h1, h2 := b.seedHashes(b.hash1(value), b.hash2(value))
+	for h := 0; h < k; h++ {
+		index := kiMiHash(h1, h2, h, b.m)
+		b.checkIndex(index)
+		if !b.bucket.test(index) {
+			return false
+		}
+	}
+	return true
+}
+
+// HashIndices returns the indices of the k bits that represent the given value in the filter, in the order
+// of the hash functions, without changing the filter. Indices can repeat, when several hash functions map
+// the value to the same bit.
+func (b *BloomFilter) HashIndices(value []byte) []int {
+	h1, h2 := b.seedHashes(b.hash1(value), b.hash2(value))
+	indices := make([]int, b.k)
+	for h := range indices {
+		indices[h] = kiMiHash(h1, h2, h, b.m)
+	}
+	return indices
+}
+
+// HashOnly returns the two base hashes of the given value, exactly as AddBytes and ContainsBytes calculate them
+// before setting or testing any bits. They can be passed to AddHashed and ContainsHashed with the same result as
+// passing the value to AddBytes and ContainsBytes, e.g. to hash a value once and use it with several filters
+// created with the same hash functions, or to benchmark the hashing separately from the bit operations.
+//
+// The seed given to NewSeeded is not mixed into the returned hashes, as AddHashed and ContainsHashed mix it in.
+func (b *BloomFilter) HashOnly(value []byte) (uint32, uint32) {
+	return b.hash1(value), b.hash2(value)
+}
+
+// ContainsAll tests if the set contains all of the given bytes values. It returns true if no values
+// are given.
+func (b *BloomFilter) ContainsAll(values ...[]byte) bool {
+	for _, value := range values {
+		if !b.ContainsBytes(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// ContainsAny tests if the set contains at least one of the given bytes values. It returns false if
+// no values are given.
+func (b *BloomFilter) ContainsAny(values ...[]byte) bool {
+	for _, value := range values {
+		if b.ContainsBytes(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// ContainsBatch tests if the set contains each of the given bytes values and returns the results in the
+// same order as values.
+func (b *BloomFilter) ContainsBatch(values [][]byte) []bool {
+	results := make([]bool, len(values))
+	for i, value := range values {
+		results[i] = b.ContainsBytes(value)
+	}
+	return results
+}
+
+// VerifyNoFalseNegatives returns true if all given values, which must all have been added to the set, are
+// reported as present. A bloom filter never reports added values as missing, so false indicates a bug, or
+// bits that were cleared or replaced (e.g. with ClearBit or by decoding another filter), and is meant as
+// a self-check in tests.
+func (b *BloomFilter) VerifyNoFalseNegatives(members [][]byte) bool {
+	return b.ContainsAll(members...)
 }
 
 // ContainsString tests if the set contains the given string value
@@ -133,16 +939,310 @@ func (b *BloomFilter) ContainsString(value string) bool {
 	return b.ContainsBytes([]byte(value))
 }
 
+// ContainsByte tests if the set contains the given byte value
+func (b *BloomFilter) ContainsByte(value byte) bool {
+	if b == nil {
+		return false
+	}
+	bytes := b.scratch[:1]
+	bytes[0] = value
+	return b.ContainsBytes(bytes)
+}
+
+// ContainsUInt16 tests if the set contains the given int value
+func (b *BloomFilter) ContainsUInt16(value uint16) bool {
+	if b == nil {
+		return false
+	}
+	bytes := b.scratch[:2]
+	b.byteOrder().PutUint16(bytes, value)
+	return b.ContainsBytes(bytes)
+}
+
 // ContainsUInt32 tests if the set contains the given int value
 func (b *BloomFilter) ContainsUInt32(value uint32) bool {
-	bytes := make([]byte, 4, 4)
-	binary.LittleEndian.PutUint32(bytes, value)
+	if b == nil {
+		return false
+	}
+	bytes := b.scratch[:4]
+	b.byteOrder().PutUint32(bytes, value)
 	return b.ContainsBytes(bytes)
 }
 
 // ContainsUInt64 tests if the set contains the given int value
 func (b *BloomFilter) ContainsUInt64(value uint64) bool {
-	bytes := make([]byte, 8, 8)
-	binary.LittleEndian.PutUint64(bytes, value)
+	if b == nil {
+		return false
+	}
+	bytes := b.scratch[:8]
+	b.byteOrder().PutUint64(bytes, value)
 	return b.ContainsBytes(bytes)
 }
+
+// ContainsUvarint tests if the set contains the given int value, encoded as a varint. See AddUvarint.
+func (b *BloomFilter) ContainsUvarint(value uint64) bool {
+	if b == nil {
+		return false
+	}
+	n := binary.PutUvarint(b.scratch[:], value)
+	return b.ContainsBytes(b.scratch[:n])
+}
+
+// ContainsInt tests if the set contains the given int value
+func (b *BloomFilter) ContainsInt(value int) bool {
+	return b.ContainsUInt64(uint64(int64(value)))
+}
+
+// ContainsFloat64 tests if the set contains the given float value. See AddFloat64 on how values are compared.
+func (b *BloomFilter) ContainsFloat64(value float64) bool {
+	return b.ContainsUInt64(math.Float64bits(value))
+}
+
+// ContainsComplex128 tests if the set contains the given complex value. See AddComplex128 on how values are
+// compared.
+func (b *BloomFilter) ContainsComplex128(value complex128) bool {
+	if b == nil {
+		return false
+	}
+	return b.ContainsBytes(b.encodeComplex128(value))
+}
+
+// ContainsRune tests if the set contains the given Unicode code point. See AddRune on how values are encoded.
+func (b *BloomFilter) ContainsRune(r rune) bool {
+	return b.ContainsUInt32(uint32(r))
+}
+
+// ContainsIP tests if the set contains the given IP address. See AddIP on how addresses are compared.
+func (b *BloomFilter) ContainsIP(ip net.IP) bool {
+	return b.ContainsBytes(normalizeIP(ip))
+}
+
+// ContainsFields tests if the set contains the value made of the given fields. See AddFields on how the
+// fields are combined.
+func (b *BloomFilter) ContainsFields(fields ...[]byte) bool {
+	if b == nil {
+		return false
+	}
+	return b.ContainsHashed(b.hashFields(fields))
+}
+
+// ContainsReader tests if the set contains all data read from r until io.EOF as a single value.
+// Errors returned by r are passed to the caller. If b is nil, r is not read.
+func (b *BloomFilter) ContainsReader(r io.Reader) (bool, error) {
+	if b == nil {
+		return false, nil
+	}
+	h1, h2, err := b.hashReader(r)
+	if err != nil {
+		return false, err
+	}
+	return b.ContainsHashed(h1, h2), nil
+}
+
+// ContainsTime tests if the set contains the given time value. See AddTime on how values are compared.
+func (b *BloomFilter) ContainsTime(t time.Time) bool {
+	return b.ContainsUInt64(uint64(t.UnixNano()))
+}
+
+// ContainsMarshaler tests if the set contains the binary form of the given value, as returned by its
+// MarshalBinary method. Errors returned by MarshalBinary are passed to the caller.
+func (b *BloomFilter) ContainsMarshaler(value encoding.BinaryMarshaler) (bool, error) {
+	bytes, err := value.MarshalBinary()
+	if err != nil {
+		return false, err
+	}
+	return b.ContainsBytes(bytes), nil
+}
+
+// Clear removes all elements from the set, while keeping the values of m and k.
+// The existing bit storage is reused.
+func (b *BloomFilter) Clear() {
+	b.bucket.reset()
+	b.setBits, b.stale = 0, false
+	b.inserts = 0
+	b.inputs = nil
+	b.notified = false
+}
+
+// InsertCount returns the exact number of times a value was added to the set since the filter was created or
+// last cleared (or resized), e.g. for monitoring the rate of inserts. Every call of an Add method counts, even if
+// the value was already in the set, so unlike EstimateCount this is not the number of distinct elements. Bits
+// added in bulk, e.g. by Union or SetRawBits, are not counted, and the count is not part of the encoded filter.
+func (b *BloomFilter) InsertCount() uint64 {
+	return b.inserts
+}
+
+// Resize changes the values of m and k to the optimal ones for the given number of elements and acceptable
+// false-positive rate, like New does, and allocates new bit storage.
+//
+// Bit positions depend on m, so existing elements can not be preserved: all elements are removed from the set,
+// including the values retained for GrowTo.
+func (b *BloomFilter) Resize(n int, falsePositiveRate float64) {
+	b.m, b.k = usableMK(n, falsePositiveRate)
+	b.bucket = newBitset(b.m)
+	b.setBits, b.stale = 0, false
+	b.inserts = 0
+	b.inputs = nil
+	b.notified = false
+}
+
+// RetainInputs enables keeping a copy of every value added to the set from now on, so that the filter can
+// be rebuilt with other values of m and k by GrowTo. Values added before RetainInputs is called are not
+// retained.
+//
+// Retaining values costs as much memory as the values themselves, plus the overhead of a slice for each value,
+// which is usually much more than the filter itself. Values added with AddBytes (and the methods built on it,
+// like AddString or AddUInt64), AddIfNotPresent and AddFields are retained. Retained values are not encoded by
+// MarshalBinary and the other encoding methods and are removed by Clear and Resize.
+//
+// Methods that change bits without known values stop retaining values and drop the retained ones, as the
+// retained values no longer match the elements of the set: AddHashed and AddReader, whose values can not be
+// recovered, Union, MergeInto, UnionRawBits, UnionSerialized and SetBit, which add bits of other elements, and
+// Intersect, Xor, ClearBit, SetRawBits and the decoding methods (e.g. UnmarshalBinary or ImportSparse), which
+// replace or remove bits. GrowTo returns an error after them, until RetainInputs is called again.
+func (b *BloomFilter) RetainInputs() {
+	b.retain = true
+}
+
+// forgetInputs stops retaining values and drops the retained ones. It is called when bits are changed without
+// known values, so that GrowTo returns an error instead of losing elements or adding removed ones.
+func (b *BloomFilter) forgetInputs() {
+	b.retain, b.inputs = false, nil
+}
+
+// retainInput keeps a copy of value, if retaining values is enabled.
+func (b *BloomFilter) retainInput(value []byte) {
+	if b.retain {
+		b.inputs = append(b.inputs, append([]byte{}, value...))
+	}
+}
+
+// GrowTo changes the values of m and k to the optimal ones for the given number of elements and acceptable
+// false-positive rate, like Resize does, but keeps the elements of the set by adding all retained values to
+// the resized filter. It returns an error if RetainInputs was not called before adding elements.
+func (b *BloomFilter) GrowTo(n int, falsePositiveRate float64) error {
+	if !b.retain {
+		return fmt.Errorf("bloomflt: can not grow a filter that does not retain its inputs")
+	}
+	inserts, inputs := b.inserts, b.inputs
+	b.Resize(n, falsePositiveRate)
+	for _, value := range inputs {
+		b.addHashed(b.hash1(value), b.hash2(value))
+	}
+	// The elements are kept, so adding them again does not count as inserts
+	b.inserts, b.inputs = inserts, inputs
+	return nil
+}
+
+// Clone returns a copy of the filter with its own bit storage, so that adding elements to the copy does
+// not affect the original and vice versa. The function registered with OnSaturation is not copied.
+func (b *BloomFilter) Clone() *BloomFilter {
+	filter := *b
+	filter.bucket = newBitset(b.m)
+	copy(filter.bucket, b.bucket)
+	// Retained values are never modified, only the slice holding them must not be shared
+	filter.inputs = append([][]byte(nil), b.inputs...)
+	filter.onFull, filter.notified = nil, false
+	return &filter
+}
+
+// Fold returns a copy of the filter with half as many bits, which uses less memory at the cost of a higher
+// false-positive rate. The original filter is not changed. It returns an error if m is odd.
+//
+// Bit indices are mapped to the range [0, m) by multiplication and taking the high bits (see kiMiHash),
+// not by modulo, so a hash that maps to bit i of the filter maps to bit i/2 of a filter with half as many
+// bits. Bit i of the folded filter is therefore the OR of bits 2*i and 2*i+1 of the original (and not of
+// bits i and i+m/2, as it would be with modulo), and the folded filter reports all elements of the original
+// as present, with the usual Contains methods. For the same reason, filters with more than 2^32 bits can only
+// be folded if the folded filter still has more than 2^32 bits, as larger filters map hashes to bits
+// differently.
+//
+// Like with Clone, the function registered with OnSaturation is not copied to the folded filter.
+func (b *BloomFilter) Fold() (*BloomFilter, error) {
+	if b.m%2 != 0 {
+		return nil, fmt.Errorf("bloomflt: can not fold a filter with an odd number of bits %d", b.m)
+	}
+	if uint64(b.m) > math.MaxUint32 && uint64(b.m/2) <= math.MaxUint32 {
+		return nil, fmt.Errorf("bloomflt: can not fold a filter with %d bits to %d bits or less", b.m, uint64(math.MaxUint32))
+	}
+
+	folded := *b
+	folded.m = b.m / 2
+	folded.bucket = newBitset(folded.m)
+	folded.stale = true
+	folded.inputs = append([][]byte(nil), b.inputs...)
+	folded.onFull, folded.notified = nil, false
+	b.bucket.forEach(func(index int) bool {
+		folded.bucket.set(index / 2)
+		return true
+	})
+	return &folded, nil
+}
+
+// Equal returns true if other has the same values of m and k and exactly the same bits set as b.
+func (b *BloomFilter) Equal(other *BloomFilter) bool {
+	if b.m != other.m || b.k != other.k || len(b.bucket) != len(other.bucket) {
+		return false
+	}
+	for i, word := range b.bucket {
+		if other.bucket[i] != word {
+			return false
+		}
+	}
+	return true
+}
+
+// ForEachSetBit calls fn with the index of each set bit of the filter, from 0 to m-1 in ascending order.
+// Iteration stops early if fn returns false. The filter must not be changed by fn.
+func (b *BloomFilter) ForEachSetBit(fn func(index int) bool) {
+	b.bucket.forEach(fn)
+}
+
+// SetBit sets the bit at the given index, from 0 to m-1. It is meant for tests that need filters with known
+// bits set, without finding values that hash to them. It panics if index is out of range.
+func (b *BloomFilter) SetBit(index int) {
+	b.checkIndex(index)
+	if !b.bucket.test(index) {
+		b.bucket.set(index)
+		b.setBits++
+		b.forgetInputs()
+	}
+}
+
+// ClearBit clears the bit at the given index, from 0 to m-1. Clearing bits can cause false negatives for
+// elements that were added to the set, so like SetBit it is meant for tests. It panics if index is out of
+// range.
+func (b *BloomFilter) ClearBit(index int) {
+	b.checkIndex(index)
+	if b.bucket.test(index) {
+		b.bucket.clear(index)
+		b.setBits--
+		b.forgetInputs()
+	}
+}
+
+// TestBit returns true if the bit at the given index, from 0 to m-1, is set. It panics if index is out of
+// range.
+func (b *BloomFilter) TestBit(index int) bool {
+	b.checkIndex(index)
+	return b.bucket.test(index)
+}
+
+// checkNotNil panics with a helpful message if b is nil. It is called by the Add methods before they access
+// the fields of b, which would otherwise panic with a nil pointer dereference deep inside the hashing code.
+func (b *BloomFilter) checkNotNil() {
+	if b == nil {
+		panic("bloomflt: Add called on a nil *BloomFilter, create the filter with New or NewMK first")
+	}
+}
+
+// checkIndex panics if index is not a valid bit index of the filter.
+//
+// kiMiHash always returns indices in the range [0, m), but AddHashed and ContainsHashed check them too. An index
+// from m to the end of the last word of the bucket would otherwise silently set or test a padding bit, so a
+// bug in the reduction would go unnoticed instead of failing loudly.
+func (b *BloomFilter) checkIndex(index int) {
+	if index < 0 || index >= b.m {
+		panic(fmt.Sprintf("bloomflt: bit index %d out of range [0, %d)", index, b.m))
+	}
+}
@@ -1,9 +1,21 @@
 package bloomflt
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"hash"
+	"hash/adler32"
+	"hash/crc32"
+	"hash/fnv"
 	"math"
+	"net"
+	"reflect"
+	"strings"
 	"testing"
+	"testing/iotest"
+	"time"
 )
 
 func TestNewMK(t *testing.T) {
@@ -13,6 +25,254 @@ func TestNewMK(t *testing.T) {
 	}
 }
 
+func TestNewMKZero(t *testing.T) {
+	for _, m := range []int{0, -1} {
+		b := NewMK(m, 3)
+		b.AddString("SomeValue")
+		ok := b.ContainsString("SomeValue")
+		if !ok {
+			t.Errorf("NewMK(%d, 3).ContainsString(%q) = %v, want %v", m, "SomeValue", ok, true)
+		}
+	}
+}
+
+func TestMK(t *testing.T) {
+	b := NewMK(64, 2)
+	if b.M() != 64 {
+		t.Errorf("b.M() = %v, want %v", b.M(), 64)
+	}
+	if b.K() != 2 {
+		t.Errorf("b.K() = %v, want %v", b.K(), 2)
+	}
+}
+
+func TestNewWithHashes(t *testing.T) {
+	b := NewWithHashes(1024, 3, fnv.New32, adler32.New)
+	d := NewMK(1024, 3)
+	for i := 0; i < 10; i++ {
+		value := fmt.Sprintf("value%d", i)
+		b.AddString(value)
+		d.AddString(value)
+	}
+
+	for i := 0; i < 10; i++ {
+		value := fmt.Sprintf("value%d", i)
+		ok := b.ContainsString(value)
+		if !ok {
+			t.Errorf("b.ContainsString(%q) = %v, want %v", value, ok, true)
+		}
+	}
+	if b.Equal(d) {
+		t.Errorf("filter with custom hashes has the same bits as filter with default hashes")
+	}
+
+	c := b.Clone()
+	c.AddString("AnotherValue")
+	b.AddString("AnotherValue")
+	if !b.Equal(c) {
+		t.Errorf("b.Clone() does not use the same hash functions as b")
+	}
+}
+
+func TestNewWithHashesReusesHashers(t *testing.T) {
+	created := 0
+	newHash := func() hash.Hash32 {
+		created++
+		return fnv.New32()
+	}
+	b := NewWithHashes(1024, 3, newHash, adler32.New)
+	for i := 0; i < 100; i++ {
+		b.AddString(fmt.Sprintf("value%d", i))
+		b.ContainsString(fmt.Sprintf("value%d", i))
+	}
+	// The pool can drop hash functions at any time (and does so on purpose with the race detector), so only
+	// check that most of them were reused
+	if created >= 100 {
+		t.Errorf("b.AddString() and b.ContainsString() created %d hash functions for 200 values, want them reused", created)
+	}
+
+	// Reused hash functions must be reset, so that they return the same hash as new ones
+	for i := 0; i < 100; i++ {
+		value := []byte(fmt.Sprintf("value%d", i))
+		f1, f2 := fnv.New32(), adler32.New()
+		f1.Write(value)
+		f2.Write(value)
+		h1, h2 := b.HashOnly(value)
+		if h1 != f1.Sum32() || h2 != f2.Sum32() {
+			t.Errorf("b.HashOnly(%q) = %#x, %#x, want %#x, %#x", value, h1, h2, f1.Sum32(), f2.Sum32())
+		}
+	}
+
+	value := []byte("value0")
+	allocs := testing.AllocsPerRun(100, func() {
+		b.ContainsBytes(value)
+	})
+	if allocs != 0 {
+		t.Errorf("b.ContainsBytes() with custom hashes allocates %v times, want %v", allocs, 0)
+	}
+}
+
+func TestNewFNVFalsePositiveRate(t *testing.T) {
+	for _, rate := range []float64{0.1, 0.01, 0.001} {
+		n := 10000
+		m, k := CalcOptimalMK(n, rate)
+		filters := map[string]*BloomFilter{
+			"FNV-1a and CRC32": NewMK(m, k),
+			"FNV-1a and FNV-1": NewFNV(m, k),
+		}
+
+		want := math.Pow(1-math.Exp(-float64(k*n)/float64(m)), float64(k))
+		for name, b := range filters {
+			for i := 0; i < n; i++ {
+				b.AddString(fmt.Sprintf("user-%d@example.com", i))
+			}
+
+			trials := int(1000 / rate)
+			positives := 0
+			for i := 0; i < trials; i++ {
+				if b.ContainsString(fmt.Sprintf("user-%d@example.org", i)) {
+					positives++
+				}
+			}
+			got := float64(positives) / float64(trials)
+			if math.Abs(got-want)/want > 0.2 {
+				t.Errorf("%s with rate %v measured false-positive rate %v, want %v +/- 20%%", name, rate, got, want)
+			}
+		}
+	}
+}
+
+func TestNewSeeded(t *testing.T) {
+	b1 := NewSeeded(1024, 3, 42)
+	b2 := NewSeeded(1024, 3, 42)
+	b3 := NewSeeded(1024, 3, 43)
+	for i := 0; i < 50; i++ {
+		value := fmt.Sprintf("value%d", i)
+		b1.AddString(value)
+		b2.AddString(value)
+		b3.AddString(value)
+	}
+
+	if !b1.Equal(b2) {
+		t.Errorf("filters with the same seed have different bits")
+	}
+	if b1.Equal(b3) {
+		t.Errorf("filters with different seeds have the same bits")
+	}
+	for i := 0; i < 50; i++ {
+		value := fmt.Sprintf("value%d", i)
+		ok := b3.ContainsString(value)
+		if !ok {
+			t.Errorf("b3.ContainsString(%q) = %v, want %v", value, ok, true)
+		}
+	}
+
+	b0 := NewSeeded(1024, 3, 0)
+	d := NewMK(1024, 3)
+	b0.AddString("SomeValue")
+	d.AddString("SomeValue")
+	if !b0.Equal(d) {
+		t.Errorf("NewSeeded(1024, 3, 0) sets different bits than NewMK(1024, 3)")
+	}
+}
+
+func TestNewWithDomain(t *testing.T) {
+	b1 := NewWithDomain(1024, 3, []byte("users"))
+	b2 := NewWithDomain(1024, 3, []byte("users"))
+	b3 := NewWithDomain(1024, 3, []byte("groups"))
+	for i := 0; i < 50; i++ {
+		value := fmt.Sprintf("value%d", i)
+		b1.AddString(value)
+		b2.AddString(value)
+		b3.AddString(value)
+	}
+
+	if !b1.Equal(b2) {
+		t.Errorf("filters with the same domain have different bits")
+	}
+	if b1.Equal(b3) {
+		t.Errorf("filters with different domains have the same bits")
+	}
+	for i := 0; i < 50; i++ {
+		value := fmt.Sprintf("value%d", i)
+		ok := b3.ContainsString(value)
+		if !ok {
+			t.Errorf("b3.ContainsString(%q) = %v, want %v", value, ok, true)
+		}
+	}
+
+	// The domain is hashed in all the ways a value can be given
+	value := []byte("SomeValue")
+	b1.AddBytes(value)
+	ok, err := b1.ContainsReader(bytes.NewReader(value))
+	if !ok || err != nil {
+		t.Errorf("b1.ContainsReader(%q) = %v, %v, want %v, nil", value, ok, err, true)
+	}
+	ok = b1.ContainsHashed(b1.HashOnly(value))
+	if !ok {
+		t.Errorf("b1.ContainsHashed(b1.HashOnly(%q)) = %v, want %v", value, ok, true)
+	}
+	b1.AddFields([]byte("a"), []byte("bc"))
+	ok = b1.ContainsBytes([]byte("\x01a\x02bc"))
+	if !ok {
+		t.Errorf("b1.ContainsBytes() of fields added with AddFields = %v, want %v", ok, true)
+	}
+	h := NewWithDomain(1024, 3, []byte("users"))
+	h.newHash1, h.newHash2, h.hashers = fnv.New32a, crc32.NewIEEE, newHasherPool(fnv.New32a, crc32.NewIEEE)
+	h1, h2 := h.HashOnly(value)
+	w1, w2 := b1.HashOnly(value)
+	if h1 != w1 || h2 != w2 {
+		t.Errorf("h.HashOnly(%q) with pooled hashers = %#x, %#x, want %#x, %#x", value, h1, h2, w1, w2)
+	}
+
+	// The length of the domain separates it from the value
+	a := NewWithDomain(1024, 3, []byte("a"))
+	ab := NewWithDomain(1024, 3, []byte("ab"))
+	a.AddString("bc")
+	ab.AddString("c")
+	if a.Equal(ab) {
+		t.Errorf("domain %q with value %q sets the same bits as domain %q with value %q", "a", "bc", "ab", "c")
+	}
+
+	for _, domain := range [][]byte{nil, {}} {
+		b0 := NewWithDomain(1024, 3, domain)
+		d := NewMK(1024, 3)
+		b0.AddString("SomeValue")
+		d.AddString("SomeValue")
+		if !b0.Equal(d) {
+			t.Errorf("NewWithDomain(1024, 3, %q) sets different bits than NewMK(1024, 3)", domain)
+		}
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		b1.ContainsBytes(value)
+	})
+	if allocs != 0 {
+		t.Errorf("b1.ContainsBytes() with domain allocates %v times, want %v", allocs, 0)
+	}
+}
+
+func TestNewWithByteOrder(t *testing.T) {
+	little := NewMK(1024, 3)
+	big := NewWithByteOrder(1024, 3, binary.BigEndian)
+
+	big.AddUInt32(0x01020304)
+	little.AddUInt32(0x04030201)
+	if !big.Equal(little) {
+		t.Errorf("big.AddUInt32(%#x) did not set the same bits as little.AddUInt32(%#x)", 0x01020304, 0x04030201)
+	}
+
+	big.AddInt(1)
+	ok := big.ContainsInt(1)
+	if !ok {
+		t.Errorf("big.ContainsInt(%v) = %v, want %v", 1, ok, true)
+	}
+	ok = big.Frozen().ContainsUInt64(1)
+	if !ok {
+		t.Errorf("big.Frozen().ContainsUInt64(%v) = %v, want %v", 1, ok, true)
+	}
+}
+
 func TestCalcOptimalMK(t *testing.T) {
 	gotM, gotK := CalcOptimalMK(216553, 0.01)
 	wantM := 2075673
@@ -25,6 +285,163 @@ func TestCalcOptimalMK(t *testing.T) {
 	}
 }
 
+func TestOptimalK(t *testing.T) {
+	for _, tt := range []struct {
+		m, n int
+		want float64
+	}{
+		{2075673, 216553, 6.643856},
+		{1000, 1000, 0.693147},
+		{0, 100, 0},
+		{100, 0, 0},
+	} {
+		got := OptimalK(tt.m, tt.n)
+		if math.Abs(got-tt.want) > 1e-6 {
+			t.Errorf("OptimalK(%v, %v) = %v, want %v", tt.m, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestNewBitsPerElement(t *testing.T) {
+	for _, tt := range []struct {
+		n              int
+		bitsPerElement float64
+		wantM, wantK   int
+	}{
+		{1000, 10, 10000, 7},
+		{1000, 9.585, 9585, 7},
+		{1000, 1, 1000, 1},
+		{0, 10, 1, 7},
+		{1000, 0, 1, 1},
+	} {
+		b := NewBitsPerElement(tt.n, tt.bitsPerElement)
+		if b.M() != tt.wantM || b.K() != tt.wantK {
+			t.Errorf("NewBitsPerElement(%v, %v) m, k = %v, %v, want %v, %v", tt.n, tt.bitsPerElement, b.M(), b.K(), tt.wantM, tt.wantK)
+		}
+	}
+}
+
+func TestNewFixedM(t *testing.T) {
+	for _, tt := range []struct {
+		m, n         int
+		wantM, wantK int
+	}{
+		{8 * 1024 * 1024, 1000000, 8 * 1024 * 1024, 6},
+		{10000, 1000, 10000, 7},
+		{1000, 1000, 1000, 1},
+		{1000, 100000, 1000, 1},
+		{1000, 0, 1000, 1},
+		{0, 1000, 1, 1},
+	} {
+		b := NewFixedM(tt.m, tt.n)
+		if b.M() != tt.wantM || b.K() != tt.wantK {
+			t.Errorf("NewFixedM(%v, %v) m, k = %v, %v, want %v, %v", tt.m, tt.n, b.M(), b.K(), tt.wantM, tt.wantK)
+		}
+	}
+}
+
+func TestNewValidated(t *testing.T) {
+	b, err := NewValidated(216553, 0.01)
+	if err != nil {
+		t.Fatalf("NewValidated(216553, 0.01) returned error: %v", err)
+	}
+	if b.M() != 2075673 || b.K() != 7 {
+		t.Errorf("NewValidated(216553, 0.01) m, k = %v, %v, want %v, %v", b.M(), b.K(), 2075673, 7)
+	}
+
+	for _, tt := range []struct {
+		n    int
+		rate float64
+	}{
+		{-1, 0.01},
+		{0, 0.01},
+		{100, 0},
+		{100, 1},
+		{100, -0.5},
+		{100, 1.5},
+		{100, math.NaN()},
+		{100, 0.9},
+		{1 << 30, 0.01},
+	} {
+		b, err := NewValidated(tt.n, tt.rate)
+		if err == nil {
+			t.Errorf("NewValidated(%v, %v) = m=%d, k=%d, want error", tt.n, tt.rate, b.M(), b.K())
+		}
+	}
+}
+
+func TestCalcOptimalMKChecked(t *testing.T) {
+	m, k, err := CalcOptimalMKChecked(216553, 0.01)
+	if err != nil {
+		t.Fatalf("CalcOptimalMKChecked(216553, 0.01) returned error: %v", err)
+	}
+	wantM, wantK := CalcOptimalMK(216553, 0.01)
+	if m != wantM || k != wantK {
+		t.Errorf("CalcOptimalMKChecked(216553, 0.01) = %v, %v, want %v, %v", m, k, wantM, wantK)
+	}
+
+	for _, tt := range []struct {
+		n    int
+		rate float64
+	}{
+		{100, 0},
+		{100, 1},
+		{-1, 0.01},
+		{0, 0.01},
+		{100, math.Inf(-1)},
+		{100, math.NaN()},
+		{math.MaxInt, 1e-300},
+		{1 << 30, 0.01},
+	} {
+		m, k, err := CalcOptimalMKChecked(tt.n, tt.rate)
+		if !errors.Is(err, ErrInvalidParams) {
+			t.Errorf("CalcOptimalMKChecked(%v, %v) = %v, %v, %v, want %v", tt.n, tt.rate, m, k, err, ErrInvalidParams)
+		}
+		if m != 0 || k != 0 {
+			t.Errorf("CalcOptimalMKChecked(%v, %v) = %v, %v, want 0, 0 with error", tt.n, tt.rate, m, k)
+		}
+	}
+}
+
+func TestNewClamped(t *testing.T) {
+	b, clamped := NewClamped(216553, 0.01)
+	if clamped {
+		t.Errorf("NewClamped(216553, 0.01) clamped = %v, want %v", clamped, false)
+	}
+	if b.M() != 2075673 || b.K() != 7 {
+		t.Errorf("NewClamped(216553, 0.01) m, k = %v, %v, want %v, %v", b.M(), b.K(), 2075673, 7)
+	}
+
+	for _, tt := range []struct {
+		n    int
+		rate float64
+	}{
+		{0, 0.01},
+		{100, 0.9},
+		{100, math.NaN()},
+		{math.MaxInt / 4, 0.01},
+	} {
+		_, _, clamped := clampedMK(tt.n, tt.rate)
+		if !clamped {
+			t.Errorf("clampedMK(%v, %v) clamped = %v, want %v", tt.n, tt.rate, clamped, true)
+		}
+	}
+
+	// The number of bits is limited to a size that can be allocated
+	b, clamped = NewClamped(math.MaxInt/4, 0.01)
+	if !clamped {
+		t.Errorf("NewClamped(%v, 0.01) clamped = %v, want %v", math.MaxInt/4, clamped, true)
+	}
+	if b.M() != maxAllocBits {
+		t.Errorf("NewClamped(%v, 0.01) m = %v, want %v", math.MaxInt/4, b.M(), maxAllocBits)
+	}
+	b.AddString("SomeValue")
+	ok := b.ContainsString("SomeValue")
+	if !ok {
+		t.Errorf("b.ContainsString(%q) = %v, want %v", "SomeValue", ok, true)
+	}
+}
+
 func TestHighFalsePositiveRate(t *testing.T) {
 	b := New(100, 0.01)
 
@@ -95,6 +512,182 @@ func TestMaximum(t *testing.T) {
 	}
 }
 
+func TestMaximumExceeds32Bits(t *testing.T) {
+	if math.MaxInt == math.MaxInt32 {
+		t.Skip("filters with more than 2^32 bits require a 64-bit platform")
+	}
+
+	// Do not allocate the bucket, only check the computed indices
+	shift := 34
+	m := 1 << uint(shift)
+	b := &BloomFilter{m: m, k: 10}
+	above := 0
+	for i := 0; i < 1000; i++ {
+		value := []byte(fmt.Sprintf("value%d", i))
+		h1, h2 := b.hash1(value), b.hash2(value)
+		for h := 0; h < b.k; h++ {
+			index := kiMiHash(h1, h2, h, b.m)
+			if index < 0 || index >= m {
+				t.Fatalf("kiMiHash(%q, %d) = %v, want value from 0 to %v", value, h, index, m-1)
+			}
+			if uint64(index) > math.MaxUint32 {
+				above++
+			}
+		}
+	}
+	if above == 0 {
+		t.Errorf("kiMiHash() never returned an index above 2^32 for m = %v", m)
+	}
+}
+
+func TestKiMiHashUniform(t *testing.T) {
+	// 2^32 is not divisible by m, so some indices are produced by more hash values than others
+	m := 2000000000
+	b := &BloomFilter{m: m, k: 4}
+
+	const bins = 10
+	var counts [bins]int
+	total := 0
+	for i := 0; i < 100000; i++ {
+		value := []byte(fmt.Sprintf("value%d", i))
+		h1, h2 := b.hash1(value), b.hash2(value)
+		for h := 0; h < b.k; h++ {
+			index := kiMiHash(h1, h2, h, b.m)
+			if index < 0 || index >= m {
+				t.Fatalf("kiMiHash(%q, %d) = %v, want value from 0 to %v", value, h, index, m-1)
+			}
+			counts[index/(m/bins)]++
+			total++
+		}
+	}
+
+	// With modulo reduction the first bin would get about 1.5 times more indices than the last ones
+	want := float64(total) / bins
+	for i, count := range counts {
+		deviation := math.Abs(float64(count)-want) / want
+		if deviation > 0.05 {
+			t.Errorf("bin %d has %d indices, want %v +/- 5%%", i, count, want)
+		}
+	}
+}
+
+func TestKiMiHashWraparound(t *testing.T) {
+	// Base hashes and hash indices for which h1 + i*h2 + (i^3-i)/6 overflows uint32
+	hashes := []uint32{0, 1, math.MaxUint32 / 2, math.MaxUint32 - 1, math.MaxUint32}
+	ms := []uint64{1, 2, 63, 64, 65, math.MaxInt32, math.MaxUint32 - 1, math.MaxUint32, math.MaxUint32 + 1,
+		math.MaxUint32 + 2, 1 << 40}
+
+	for _, m64 := range ms {
+		if m64 > math.MaxInt {
+			// Filters with more than 2^31-1 bits require a 64-bit platform
+			continue
+		}
+		m := int(m64)
+		for _, h1 := range hashes {
+			for _, h2 := range hashes {
+				for _, h := range []int{0, 1, 2, 1000, 1625, 1626, math.MaxInt32} {
+					index := kiMiHash(h1, h2, h, m)
+					if index < 0 || index >= m {
+						t.Fatalf("kiMiHash(%#x, %#x, %d, %d) = %v, want value from 0 to %v", h1, h2, h, m, index, m-1)
+					}
+				}
+			}
+		}
+	}
+
+	// The last word of the bucket has padding bits above m, which must never be set
+	b := NewMK(65, 30)
+	for _, h1 := range hashes {
+		for _, h2 := range hashes {
+			b.AddHashed(h1, h2)
+			ok := b.ContainsHashed(h1, h2)
+			if !ok {
+				t.Errorf("b.ContainsHashed(%#x, %#x) = %v, want %v", h1, h2, ok, true)
+			}
+		}
+	}
+	if padding := b.bucket[1] >> 1; padding != 0 {
+		t.Errorf("b.AddHashed() set padding bits %#x above m", padding)
+	}
+}
+
+func TestFalsePositiveRateMatchesTheory(t *testing.T) {
+	for _, tt := range []struct {
+		n    int
+		rate float64
+	}{
+		{10000, 0.1},
+		{10000, 0.01},
+		{1000, 0.001},
+	} {
+		b := New(tt.n, tt.rate)
+		for i := 0; i < tt.n; i++ {
+			b.AddString(fmt.Sprintf("member%d", i))
+		}
+
+		trials := int(1000 / tt.rate)
+		positives := 0
+		for i := 0; i < trials; i++ {
+			if b.ContainsString(fmt.Sprintf("other%d", i)) {
+				positives++
+			}
+		}
+
+		m, k, n := float64(b.m), float64(b.k), float64(tt.n)
+		want := math.Pow(1-math.Exp(-k*n/m), k)
+		got := float64(positives) / float64(trials)
+		if math.Abs(got-want)/want > 0.2 {
+			t.Errorf("New(%v, %v) measured false-positive rate %v, want %v +/- 20%%", tt.n, tt.rate, got, want)
+		}
+	}
+}
+
+func TestByte(t *testing.T) {
+	b := New(100, 0.01)
+
+	value := byte(200)
+
+	ok := b.ContainsByte(value)
+	if ok {
+		t.Errorf("b.ContainsByte(%v) = %v, want %v", value, ok, false)
+	}
+
+	b.AddByte(value)
+	ok = b.ContainsByte(value)
+	if !ok {
+		t.Errorf("b.ContainsByte(%v) = %v, want %v", value, ok, true)
+	}
+
+	// Bytes are encoded with a single byte
+	ok = b.ContainsBytes([]byte{value})
+	if !ok {
+		t.Errorf("b.ContainsBytes(%v) = %v, want %v", []byte{value}, ok, true)
+	}
+}
+
+func TestUInt16(t *testing.T) {
+	b := New(100, 0.01)
+
+	value := uint16(math.MaxUint16 / 2)
+
+	ok := b.ContainsUInt16(value)
+	if ok {
+		t.Errorf("b.ContainsUInt16(%v) = %v, want %v", value, ok, false)
+	}
+
+	b.AddUInt16(value)
+	ok = b.ContainsUInt16(value)
+	if !ok {
+		t.Errorf("b.ContainsUInt16(%v) = %v, want %v", value, ok, true)
+	}
+
+	// Values of different width are different elements
+	ok = b.ContainsUInt32(uint32(value))
+	if ok {
+		t.Errorf("b.ContainsUInt32(%v) = %v, want %v", value, ok, false)
+	}
+}
+
 func TestUInt32(t *testing.T) {
 	b := New(100, 0.01)
 
@@ -129,21 +722,1251 @@ func TestUInt64(t *testing.T) {
 	}
 }
 
-func Example() {
-	// We expect the set to contains up to 100 elements with acceptable false-positive rate of 0.01%
+func TestUvarint(t *testing.T) {
 	b := New(100, 0.01)
 
-	b.AddString("value1")
-	if b.ContainsString("value1") {
-		fmt.Println("The set now has 'value1'.")
+	for _, value := range []uint64{0, 300, math.MaxUint64} {
+		ok := b.ContainsUvarint(value)
+		if ok {
+			t.Errorf("b.ContainsUvarint(%v) = %v, want %v", value, ok, false)
+		}
+
+		b.AddUvarint(value)
+		ok = b.ContainsUvarint(value)
+		if !ok {
+			t.Errorf("b.ContainsUvarint(%v) = %v, want %v", value, ok, true)
+		}
 	}
 
-	someID := uint64(123)
-	b.AddUInt64(someID)
-	if b.ContainsUInt64(someID) {
-		fmt.Printf("The set now has ID %v.", someID)
+	// 300 is encoded as 0xac 0x02
+	ok := b.ContainsBytes([]byte{0xac, 0x02})
+	if !ok {
+		t.Errorf("b.ContainsBytes(%v) = %v, want %v", []byte{0xac, 0x02}, ok, true)
+	}
+	ok = b.ContainsUInt64(300)
+	if ok {
+		t.Errorf("b.ContainsUInt64(%v) = %v, want %v", 300, ok, false)
+	}
+}
+
+func TestUIntAllocations(t *testing.T) {
+	b := New(100, 0.01)
+
+	for name, f := range map[string]func(){
+		"AddUInt32":          func() { b.AddUInt32(32) },
+		"AddUInt64":          func() { b.AddUInt64(64) },
+		"AddUvarint":         func() { b.AddUvarint(math.MaxUint64) },
+		"ContainsUInt32":     func() { b.ContainsUInt32(32) },
+		"ContainsUInt64":     func() { b.ContainsUInt64(64) },
+		"ContainsUvarint":    func() { b.ContainsUvarint(math.MaxUint64) },
+		"AddComplex128":      func() { b.AddComplex128(complex(1, 2)) },
+		"ContainsComplex128": func() { b.ContainsComplex128(complex(1, 2)) },
+	} {
+		allocs := testing.AllocsPerRun(100, f)
+		if allocs != 0 {
+			t.Errorf("b.%s() allocates %v times, want %v", name, allocs, 0)
+		}
 	}
+}
 
-	// Output: The set now has 'value1'.
-	// The set now has ID 123.
+func TestAddHighestBitAllocations(t *testing.T) {
+	b := NewMK(1<<24, 1)
+
+	// With h2 equal to zero, the first index of h1 = MaxUint32 is the highest bit of the filter
+	allocs := testing.AllocsPerRun(1, func() { b.AddHashed(math.MaxUint32, 0) })
+	if allocs != 0 {
+		t.Errorf("b.AddHashed() of the highest bit allocates %v times, want %v", allocs, 0)
+	}
+	if !b.bucket.test(b.m - 1) {
+		t.Errorf("b.AddHashed(%v, %v) did not set bit %v", uint32(math.MaxUint32), 0, b.m-1)
+	}
+}
+
+func TestInt(t *testing.T) {
+	b := New(100, 0.01)
+
+	for _, value := range []int{-1, math.MinInt32, math.MaxInt32} {
+		ok := b.ContainsInt(value)
+		if ok {
+			t.Errorf("b.ContainsInt(%v) = %v, want %v", value, ok, false)
+		}
+
+		b.AddInt(value)
+		ok = b.ContainsInt(value)
+		if !ok {
+			t.Errorf("b.ContainsInt(%v) = %v, want %v", value, ok, true)
+		}
+	}
+
+	// Ints are encoded as 8 bytes on every platform
+	ok := b.ContainsUInt64(uint64(math.MaxInt32))
+	if !ok {
+		t.Errorf("b.ContainsUInt64(%v) = %v, want %v", math.MaxInt32, ok, true)
+	}
+}
+
+func TestFloat64(t *testing.T) {
+	b := New(100, 0.01)
+
+	value := 3.14159
+	ok := b.ContainsFloat64(value)
+	if ok {
+		t.Errorf("b.ContainsFloat64(%v) = %v, want %v", value, ok, false)
+	}
+
+	b.AddFloat64(value)
+	ok = b.ContainsFloat64(value)
+	if !ok {
+		t.Errorf("b.ContainsFloat64(%v) = %v, want %v", value, ok, true)
+	}
+
+	// +0.0 and -0.0 have different bit patterns
+	b.AddFloat64(0)
+	ok = b.ContainsFloat64(math.Copysign(0, -1))
+	if ok {
+		t.Errorf("b.ContainsFloat64(%v) = %v, want %v", math.Copysign(0, -1), ok, false)
+	}
+}
+
+func TestComplex128(t *testing.T) {
+	b := New(100, 0.01)
+
+	value := complex(3.14159, -2.71828)
+	ok := b.ContainsComplex128(value)
+	if ok {
+		t.Errorf("b.ContainsComplex128(%v) = %v, want %v", value, ok, false)
+	}
+
+	b.AddComplex128(value)
+	for _, tt := range []struct {
+		value complex128
+		want  bool
+	}{
+		{value, true},
+		{complex(-2.71828, 3.14159), false},
+		{complex(3.14159, 0), false},
+		// +0.0 and -0.0 have different bit patterns
+		{complex(0, math.Copysign(0, -1)), false},
+	} {
+		ok = b.ContainsComplex128(tt.value)
+		if ok != tt.want {
+			t.Errorf("b.ContainsComplex128(%v) = %v, want %v", tt.value, ok, tt.want)
+		}
+	}
+
+	// The value is the same as the two parts encoded as float values
+	var data [16]byte
+	binary.LittleEndian.PutUint64(data[:], math.Float64bits(real(value)))
+	binary.LittleEndian.PutUint64(data[8:], math.Float64bits(imag(value)))
+	ok = b.ContainsBytes(data[:])
+	if !ok {
+		t.Errorf("b.ContainsBytes(%v) = %v, want %v", data, ok, true)
+	}
+}
+
+func TestVerifyNoFalseNegatives(t *testing.T) {
+	b := New(1000, 0.01)
+	members := make([][]byte, 1000)
+	for i := range members {
+		members[i] = []byte(fmt.Sprintf("value%d", i))
+		b.AddBytes(members[i])
+	}
+
+	ok := b.VerifyNoFalseNegatives(members)
+	if !ok {
+		t.Errorf("b.VerifyNoFalseNegatives() = %v, want %v", ok, true)
+	}
+
+	b.ClearBit(kiMiHash(fnvHash(members[0]), crcHash(members[0]), 0, b.m))
+	ok = b.VerifyNoFalseNegatives(members)
+	if ok {
+		t.Errorf("b.VerifyNoFalseNegatives() after ClearBit() = %v, want %v", ok, false)
+	}
+}
+
+func TestContainsBytesK(t *testing.T) {
+	b := NewMK(1000, 7)
+	for i := 0; i < 100; i++ {
+		b.AddString(fmt.Sprintf("value%d", i))
+	}
+
+	previous := 0
+	for k := b.K(); k >= 1; k-- {
+		found := 0
+		for i := 0; i < 1000; i++ {
+			value := []byte(fmt.Sprintf("value%d", i))
+			ok := b.ContainsBytesK(value, k)
+			if i < 100 && !ok {
+				t.Errorf("b.ContainsBytesK(%q, %d) = %v, want %v", value, k, ok, true)
+			}
+			if ok {
+				found++
+			}
+			if k == b.K() && ok != b.ContainsBytes(value) {
+				t.Errorf("b.ContainsBytesK(%q, %d) = %v, want same as ContainsBytes", value, k, ok)
+			}
+		}
+		// Testing fewer bits can only find more values
+		if found < previous {
+			t.Errorf("b.ContainsBytesK() with k=%d found %d values, want at least %d", k, found, previous)
+		}
+		previous = found
+	}
+
+	for _, k := range []int{0, -1, b.K() + 1} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("b.ContainsBytesK() with k=%d did not panic", k)
+				}
+			}()
+			b.ContainsBytesK([]byte("value0"), k)
+		}()
+	}
+}
+
+func TestHashIndices(t *testing.T) {
+	b := NewSeeded(1024, 5, 42)
+	indices := b.HashIndices([]byte("SomeValue"))
+	if len(indices) != 5 {
+		t.Fatalf("len(b.HashIndices(%q)) = %v, want %v", "SomeValue", len(indices), 5)
+	}
+	if !b.IsEmpty() {
+		t.Errorf("b.HashIndices(%q) changed the filter", "SomeValue")
+	}
+
+	b.AddString("SomeValue")
+	for _, index := range indices {
+		if !b.TestBit(index) {
+			t.Errorf("b.TestBit(%v) after b.AddString(%q) = %v, want %v", index, "SomeValue", false, true)
+		}
+	}
+	// Each hash function sets at most one bit
+	if b.PopCount() > len(indices) {
+		t.Errorf("b.PopCount() = %v, want at most %v", b.PopCount(), len(indices))
+	}
+}
+
+func TestRune(t *testing.T) {
+	b := New(100, 0.01)
+
+	for _, r := range "aЖ世😀" {
+		ok := b.ContainsRune(r)
+		if ok {
+			t.Errorf("b.ContainsRune(%q) = %v, want %v", r, ok, false)
+		}
+
+		b.AddRune(r)
+		ok = b.ContainsRune(r)
+		if !ok {
+			t.Errorf("b.ContainsRune(%q) = %v, want %v", r, ok, true)
+		}
+	}
+
+	// Runes are encoded as 4 bytes, not as UTF-8
+	ok := b.ContainsString("a")
+	if ok {
+		t.Errorf("b.ContainsString(%q) = %v, want %v", "a", ok, false)
+	}
+}
+
+func TestIP(t *testing.T) {
+	b := New(100, 0.01)
+
+	ip := net.ParseIP("1.2.3.4").To4()
+	ok := b.ContainsIP(ip)
+	if ok {
+		t.Errorf("b.ContainsIP(%v) = %v, want %v", ip, ok, false)
+	}
+
+	b.AddIP(ip)
+	for _, value := range []string{"1.2.3.4", "::ffff:1.2.3.4"} {
+		ok = b.ContainsIP(net.ParseIP(value))
+		if !ok {
+			t.Errorf("b.ContainsIP(%v) = %v, want %v", value, ok, true)
+		}
+	}
+
+	b.AddIP(net.ParseIP("2001:db8::1"))
+	for _, tt := range []struct {
+		value string
+		want  bool
+	}{
+		{"2001:db8::1", true},
+		{"2001:db8::2", false},
+		{"1.2.3.5", false},
+	} {
+		ok = b.ContainsIP(net.ParseIP(tt.value))
+		if ok != tt.want {
+			t.Errorf("b.ContainsIP(%v) = %v, want %v", tt.value, ok, tt.want)
+		}
+	}
+}
+
+func TestAddIfNotPresent(t *testing.T) {
+	b := NewMK(1024, 3)
+
+	added := b.AddIfNotPresent([]byte("SomeValue"))
+	if !added {
+		t.Errorf("b.AddIfNotPresent(%q) = %v, want %v", "SomeValue", added, true)
+	}
+	ok := b.ContainsString("SomeValue")
+	if !ok {
+		t.Errorf("b.ContainsString(%q) = %v, want %v", "SomeValue", ok, true)
+	}
+
+	added = b.AddIfNotPresent([]byte("SomeValue"))
+	if added {
+		t.Errorf("b.AddIfNotPresent(%q) for a present value = %v, want %v", "SomeValue", added, false)
+	}
+}
+
+func TestAddBytesChecked(t *testing.T) {
+	b := New(1000, 0.01)
+	b.AddString("SomeValue")
+
+	saturatedAt := -1
+	for i := 0; i < 2000; i++ {
+		saturated := b.AddBytesChecked([]byte(fmt.Sprintf("value%d", i)))
+		want := b.FillRatio() > 0.5
+		if saturated != want {
+			t.Fatalf("b.AddBytesChecked() after %d values = %v, want %v", i+1, saturated, want)
+		}
+		if saturated && saturatedAt < 0 {
+			saturatedAt = i + 1
+		}
+	}
+	if saturatedAt < 900 || saturatedAt > 1100 {
+		t.Errorf("b.AddBytesChecked() first reported saturation after %v values, want approximately %v", saturatedAt, 1000)
+	}
+
+	// Bits changed in bulk are counted again
+	b.Clear()
+	other := New(1000, 0.01)
+	for i := 0; i < 2000; i++ {
+		other.AddString(fmt.Sprintf("value%d", i))
+	}
+	err := b.Union(other)
+	if err != nil {
+		t.Fatalf("b.Union(other) returned error: %v", err)
+	}
+	saturated := b.AddBytesChecked([]byte("SomeValue"))
+	if !saturated {
+		t.Errorf("b.AddBytesChecked() after Union() = %v, want %v", saturated, true)
+	}
+}
+
+func TestOnSaturation(t *testing.T) {
+	b := New(1000, 0.01)
+	calls := 0
+	calledAt := 0
+	b.OnSaturation(0.5, func() {
+		calls++
+		calledAt = b.PopCount()
+	})
+
+	for i := 0; i < 2000; i++ {
+		b.AddString(fmt.Sprintf("value%d", i))
+	}
+	if calls != 1 {
+		t.Fatalf("OnSaturation(0.5) callback called %v times, want %v", calls, 1)
+	}
+	// Each value sets at most k bits
+	if calledAt <= b.M()/2 || calledAt > b.M()/2+b.K() {
+		t.Errorf("OnSaturation(0.5) callback called with %v set bits, want %v to %v", calledAt, b.M()/2+1, b.M()/2+b.K())
+	}
+
+	// The callback is called again after Clear
+	b.Clear()
+	b.AddString("SomeValue")
+	if calls != 1 {
+		t.Errorf("OnSaturation(0.5) callback called %v times after Clear(), want %v", calls, 1)
+	}
+	for i := 0; i < 2000; i++ {
+		b.AddIfNotPresent([]byte(fmt.Sprintf("value%d", i)))
+	}
+	if calls != 2 {
+		t.Errorf("OnSaturation(0.5) callback called %v times after refilling, want %v", calls, 2)
+	}
+}
+
+func TestAddStrings(t *testing.T) {
+	b := New(100, 0.01)
+
+	values := []string{"value1", "value2", "value3"}
+	b.AddStrings(values...)
+	b.AddByteSlices([]byte("value4"), []byte("value5"))
+
+	for _, value := range append(values, "value4", "value5") {
+		ok := b.ContainsString(value)
+		if !ok {
+			t.Errorf("b.ContainsString(%q) = %v, want %v", value, ok, true)
+		}
+	}
+}
+
+func TestContainsAllAny(t *testing.T) {
+	b := New(100, 0.01)
+	b.AddStrings("value1", "value2")
+
+	tests := []struct {
+		values  [][]byte
+		wantAll bool
+		wantAny bool
+	}{
+		{nil, true, false},
+		{[][]byte{[]byte("value1"), []byte("value2")}, true, true},
+		{[][]byte{[]byte("value1"), []byte("missing")}, false, true},
+		{[][]byte{[]byte("missing"), []byte("value2")}, false, true},
+		{[][]byte{[]byte("missing"), []byte("another")}, false, false},
+	}
+	for _, tt := range tests {
+		got := b.ContainsAll(tt.values...)
+		if got != tt.wantAll {
+			t.Errorf("b.ContainsAll(%q) = %v, want %v", tt.values, got, tt.wantAll)
+		}
+		got = b.ContainsAny(tt.values...)
+		if got != tt.wantAny {
+			t.Errorf("b.ContainsAny(%q) = %v, want %v", tt.values, got, tt.wantAny)
+		}
+	}
+}
+
+func TestContainsBatch(t *testing.T) {
+	b := NewMK(1024, 3)
+	b.AddString("SomeValue")
+	b.AddString("ThirdValue")
+
+	values := [][]byte{[]byte("SomeValue"), []byte("AnotherValue"), []byte("ThirdValue")}
+	got := b.ContainsBatch(values)
+	want := []bool{true, false, true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("b.ContainsBatch(%q) = %v, want %v", values, got, want)
+	}
+
+	got = b.ContainsBatch(nil)
+	if len(got) != 0 {
+		t.Errorf("b.ContainsBatch(nil) = %v, want empty slice", got)
+	}
+}
+
+func TestFields(t *testing.T) {
+	b := NewMK(1024, 3)
+
+	b.AddFields([]byte("ab"), []byte("c"))
+	ok := b.ContainsFields([]byte("ab"), []byte("c"))
+	if !ok {
+		t.Errorf("b.ContainsFields(%q, %q) = %v, want %v", "ab", "c", ok, true)
+	}
+	ok = b.ContainsFields([]byte("a"), []byte("bc"))
+	if ok {
+		t.Errorf("b.ContainsFields(%q, %q) = %v, want %v", "a", "bc", ok, false)
+	}
+
+	// Each field is preceded by its length
+	ok = b.ContainsString("\x02ab\x01c")
+	if !ok {
+		t.Errorf("b.ContainsString(%q) = %v, want %v", "\x02ab\x01c", ok, true)
+	}
+
+	fields := [][]byte{[]byte("ab"), []byte("c")}
+	allocs := testing.AllocsPerRun(100, func() { b.AddFields(fields...) })
+	if allocs != 0 {
+		t.Errorf("b.AddFields() allocates %v times, want %v", allocs, 0)
+	}
+
+	c := NewWithHashes(1024, 3, fnv.New32, adler32.New)
+	c.AddFields([]byte("ab"), []byte("c"))
+	ok = c.ContainsString("\x02ab\x01c")
+	if !ok {
+		t.Errorf("c.ContainsString(%q) = %v, want %v", "\x02ab\x01c", ok, true)
+	}
+}
+
+func TestReader(t *testing.T) {
+	b := New(100, 0.01)
+
+	value := strings.Repeat("SomeValue", 10000)
+	ok, err := b.ContainsReader(strings.NewReader(value))
+	if ok || err != nil {
+		t.Errorf("b.ContainsReader() = %v, %v, want %v, %v", ok, err, false, nil)
+	}
+
+	err = b.AddReader(iotest.HalfReader(strings.NewReader(value)))
+	if err != nil {
+		t.Errorf("b.AddReader() = %v, want %v", err, nil)
+	}
+	ok, err = b.ContainsReader(iotest.OneByteReader(strings.NewReader(value)))
+	if !ok || err != nil {
+		t.Errorf("b.ContainsReader() = %v, %v, want %v, %v", ok, err, true, nil)
+	}
+	ok = b.ContainsString(value)
+	if !ok {
+		t.Errorf("b.ContainsString() of value added with AddReader = %v, want %v", ok, true)
+	}
+}
+
+func TestReaderError(t *testing.T) {
+	b := New(100, 0.01)
+
+	errRead := errors.New("read error")
+	err := b.AddReader(iotest.ErrReader(errRead))
+	if err != errRead {
+		t.Errorf("b.AddReader() = %v, want %v", err, errRead)
+	}
+	if b.PopCount() != 0 {
+		t.Errorf("b.AddReader() with error added a value to the set")
+	}
+
+	ok, err := b.ContainsReader(iotest.ErrReader(errRead))
+	if ok || err != errRead {
+		t.Errorf("b.ContainsReader() = %v, %v, want %v, %v", ok, err, false, errRead)
+	}
+}
+
+func TestAddLines(t *testing.T) {
+	b := New(100, 0.01)
+	n, err := b.AddLines(strings.NewReader("first\r\n  second \n\nlast"))
+	if err != nil {
+		t.Fatalf("b.AddLines() returned error: %v", err)
+	}
+	if n != 4 {
+		t.Errorf("b.AddLines() = %v, want %v", n, 4)
+	}
+
+	for _, tt := range []struct {
+		value string
+		want  bool
+	}{
+		{"first", true},
+		{"  second ", true},
+		{"", true},
+		{"last", true},
+		{"first\r", false},
+		{"second", false},
+	} {
+		ok := b.ContainsString(tt.value)
+		if ok != tt.want {
+			t.Errorf("b.ContainsString(%q) = %v, want %v", tt.value, ok, tt.want)
+		}
+	}
+}
+
+func TestAddLinesTooLong(t *testing.T) {
+	b := New(100, 0.01)
+	data := "first\n" + strings.Repeat("x", maxLineLength+1) + "\nlast\n"
+	n, err := b.AddLines(strings.NewReader(data))
+	if err == nil {
+		t.Errorf("b.AddLines() with a line of %d bytes = nil, want error", maxLineLength+1)
+	}
+	if n != 1 {
+		t.Errorf("b.AddLines() with a line of %d bytes = %v, want %v", maxLineLength+1, n, 1)
+	}
+
+	// Lines up to the limit can be added, with either line terminator
+	for _, line := range []string{strings.Repeat("x", maxLineLength-1), strings.Repeat("x", maxLineLength)} {
+		for _, eol := range []string{"\n", "\r\n"} {
+			b = New(100, 0.01)
+			n, err = b.AddLines(strings.NewReader(line + eol))
+			if err != nil || n != 1 {
+				t.Errorf("b.AddLines() with a line of %d bytes ending in %q = %v, %v, want %v, nil", len(line), eol, n, err, 1)
+			}
+			ok := b.ContainsString(line)
+			if !ok {
+				t.Errorf("b.ContainsString() of a line of %d bytes ending in %q = %v, want %v", len(line), eol, ok, true)
+			}
+		}
+	}
+
+	// Longer lines fail even when the line terminator fits in the buffer
+	for _, eol := range []string{"\n", "\r\n", ""} {
+		b = New(100, 0.01)
+		line := strings.Repeat("x", maxLineLength+1)
+		n, err = b.AddLines(strings.NewReader(line + eol))
+		if err == nil || n != 0 {
+			t.Errorf("b.AddLines() with a line of %d bytes ending in %q = %v, %v, want %v, error", len(line), eol, n, err, 0)
+		}
+	}
+}
+
+func TestTime(t *testing.T) {
+	b := New(100, 0.01)
+
+	value := time.Date(2020, 2, 29, 12, 30, 15, 123456789, time.UTC)
+	ok := b.ContainsTime(value)
+	if ok {
+		t.Errorf("b.ContainsTime(%v) = %v, want %v", value, ok, false)
+	}
+
+	b.AddTime(value)
+	ok = b.ContainsTime(value)
+	if !ok {
+		t.Errorf("b.ContainsTime(%v) = %v, want %v", value, ok, true)
+	}
+
+	// The same instant in another location is the same value
+	local := value.In(time.FixedZone("UTC+2", 2*60*60))
+	ok = b.ContainsTime(local)
+	if !ok {
+		t.Errorf("b.ContainsTime(%v) = %v, want %v", local, ok, true)
+	}
+
+	truncated := value.Truncate(time.Microsecond)
+	ok = b.ContainsTime(truncated)
+	if ok {
+		t.Errorf("b.ContainsTime(%v) = %v, want %v", truncated, ok, false)
+	}
+
+	// Monotonic clock readings are ignored
+	now := time.Now()
+	b.AddTime(now)
+	ok = b.ContainsTime(now.Round(0))
+	if !ok {
+		t.Errorf("b.ContainsTime(%v) = %v, want %v", now.Round(0), ok, true)
+	}
+}
+
+func TestHashed(t *testing.T) {
+	b := New(100, 0.01)
+
+	h1, h2 := uint32(0x12345678), uint32(0x9abcdef0)
+	ok := b.ContainsHashed(h1, h2)
+	if ok {
+		t.Errorf("b.ContainsHashed(%#x, %#x) = %v, want %v", h1, h2, ok, false)
+	}
+
+	b.AddHashed(h1, h2)
+	ok = b.ContainsHashed(h1, h2)
+	if !ok {
+		t.Errorf("b.ContainsHashed(%#x, %#x) = %v, want %v", h1, h2, ok, true)
+	}
+
+	// Values added with AddBytes can be found by their base hashes
+	value := []byte("SomeValue")
+	b.AddBytes(value)
+	ok = b.ContainsHashed(b.hash1(value), b.hash2(value))
+	if !ok {
+		t.Errorf("b.ContainsHashed() of value added with AddBytes = %v, want %v", ok, true)
+	}
+}
+
+func TestHashOnly(t *testing.T) {
+	for _, b := range []*BloomFilter{New(100, 0.01), NewSeeded(1000, 7, 42), NewFNV(1000, 7)} {
+		value := []byte("SomeValue")
+		h1, h2 := b.HashOnly(value)
+		b.AddHashed(h1, h2)
+		ok := b.ContainsBytes(value)
+		if !ok {
+			t.Errorf("b.ContainsBytes(%q) of value added with HashOnly = %v, want %v", value, ok, true)
+		}
+
+		other := []byte("AnotherValue")
+		b.AddBytes(other)
+		ok = b.ContainsHashed(b.HashOnly(other))
+		if !ok {
+			t.Errorf("b.ContainsHashed(b.HashOnly(%q)) = %v, want %v", other, ok, true)
+		}
+	}
+}
+
+type testMarshaler struct {
+	value string
+	err   error
+}
+
+func (m testMarshaler) MarshalBinary() ([]byte, error) {
+	return []byte(m.value), m.err
+}
+
+func TestMarshaler(t *testing.T) {
+	b := New(100, 0.01)
+
+	value := testMarshaler{value: "SomeValue"}
+	ok, err := b.ContainsMarshaler(value)
+	if ok || err != nil {
+		t.Errorf("b.ContainsMarshaler(%q) = %v, %v, want %v, %v", value.value, ok, err, false, nil)
+	}
+
+	err = b.AddMarshaler(value)
+	if err != nil {
+		t.Errorf("b.AddMarshaler(%q) = %v, want %v", value.value, err, nil)
+	}
+	ok, err = b.ContainsMarshaler(value)
+	if !ok || err != nil {
+		t.Errorf("b.ContainsMarshaler(%q) = %v, %v, want %v, %v", value.value, ok, err, true, nil)
+	}
+	ok = b.ContainsString("SomeValue")
+	if !ok {
+		t.Errorf("b.ContainsString(%q) = %v, want %v", "SomeValue", ok, true)
+	}
+}
+
+func TestMarshalerError(t *testing.T) {
+	b := New(100, 0.01)
+
+	value := testMarshaler{err: errors.New("marshal error")}
+	err := b.AddMarshaler(value)
+	if err != value.err {
+		t.Errorf("b.AddMarshaler() = %v, want %v", err, value.err)
+	}
+	if b.ContainsBytes(nil) {
+		t.Errorf("b.AddMarshaler() with error added an empty value to the set")
+	}
+
+	ok, err := b.ContainsMarshaler(value)
+	if ok || err != value.err {
+		t.Errorf("b.ContainsMarshaler() = %v, %v, want %v, %v", ok, err, false, value.err)
+	}
+}
+
+func Example() {
+	// We expect the set to contains up to 100 elements with acceptable false-positive rate of 0.01%
+	b := New(100, 0.01)
+
+	b.AddString("value1")
+	if b.ContainsString("value1") {
+		fmt.Println("The set now has 'value1'.")
+	}
+
+	someID := uint64(123)
+	b.AddUInt64(someID)
+	if b.ContainsUInt64(someID) {
+		fmt.Printf("The set now has ID %v.", someID)
+	}
+
+	// Output: The set now has 'value1'.
+	// The set now has ID 123.
+}
+
+func TestNilFilter(t *testing.T) {
+	var b *BloomFilter
+	for _, tt := range []struct {
+		name string
+		ok   bool
+	}{
+		{"ContainsBytes", b.ContainsBytes([]byte("SomeValue"))},
+		{"ContainsString", b.ContainsString("SomeValue")},
+		{"ContainsHashed", b.ContainsHashed(1, 2)},
+		{"ContainsUInt64", b.ContainsUInt64(42)},
+		{"ContainsUvarint", b.ContainsUvarint(42)},
+		{"ContainsIP", b.ContainsIP(net.IPv4(1, 2, 3, 4))},
+		{"ContainsFields", b.ContainsFields([]byte("a"), []byte("b"))},
+		{"ContainsAny", b.ContainsAny([]byte("SomeValue"))},
+	} {
+		if tt.ok {
+			t.Errorf("b.%s() of nil filter = %v, want %v", tt.name, tt.ok, false)
+		}
+	}
+
+	ok, err := b.ContainsReader(strings.NewReader("SomeValue"))
+	if ok || err != nil {
+		t.Errorf("b.ContainsReader() of nil filter = %v, %v, want %v, nil", ok, err, false)
+	}
+
+	for name, add := range map[string]func(){
+		"AddBytes":  func() { b.AddBytes([]byte("SomeValue")) },
+		"AddString": func() { b.AddString("SomeValue") },
+		"AddUInt64": func() { b.AddUInt64(42) },
+		"AddFields": func() { b.AddFields([]byte("a")) },
+	} {
+		func() {
+			defer func() {
+				r := recover()
+				msg, _ := r.(string)
+				if !strings.Contains(msg, "nil *BloomFilter") {
+					t.Errorf("b.%s() of nil filter panicked with %v, want message about nil filter", name, r)
+				}
+			}()
+			add()
+		}()
+	}
+}
+
+func TestClear(t *testing.T) {
+	b := NewMK(1024, 3)
+	b.AddString("SomeValue")
+	b.AddString("AnotherValue")
+
+	b.Clear()
+
+	for _, value := range []string{"SomeValue", "AnotherValue"} {
+		ok := b.ContainsString(value)
+		if ok {
+			t.Errorf("b.ContainsString(%q) = %v, want %v", value, ok, false)
+		}
+	}
+	if b.m != 1024 || b.k != 3 {
+		t.Errorf("b.Clear() changed m, k to %v, %v, want %v, %v", b.m, b.k, 1024, 3)
+	}
+
+	b.AddString("SomeValue")
+	ok := b.ContainsString("SomeValue")
+	if !ok {
+		t.Errorf("b.ContainsString(%q) = %v, want %v", "SomeValue", ok, true)
+	}
+}
+
+func BenchmarkAddBytes(b *testing.B) {
+	filter := NewMK(2000000, 7)
+	values := make([][]byte, 1000)
+	for i := range values {
+		values[i] = []byte(fmt.Sprintf("value%d", i))
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		filter.AddBytes(values[i%len(values)])
+	}
+}
+
+func BenchmarkContainsBytes(b *testing.B) {
+	filter := NewMK(2000000, 7)
+	values := make([][]byte, 1000)
+	for i := range values {
+		values[i] = []byte(fmt.Sprintf("value%d", i))
+		if i%2 == 0 {
+			filter.AddBytes(values[i])
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		filter.ContainsBytes(values[i%len(values)])
+	}
+}
+
+func TestInsertCount(t *testing.T) {
+	b := New(100, 0.01)
+	b.RetainInputs()
+	for i := 0; i < 10; i++ {
+		b.AddString("SomeValue")
+	}
+	b.AddUInt64(42)
+	b.AddFields([]byte("a"), []byte("b"))
+	b.AddIfNotPresent([]byte("SomeValue"))
+	inserts := b.InsertCount()
+	if inserts != 13 {
+		t.Errorf("b.InsertCount() = %v, want %v", inserts, 13)
+	}
+
+	err := b.GrowTo(1000, 0.01)
+	if err != nil {
+		t.Fatalf("b.GrowTo() returned error: %v", err)
+	}
+	inserts = b.InsertCount()
+	if inserts != 13 {
+		t.Errorf("b.InsertCount() after GrowTo() = %v, want %v", inserts, 13)
+	}
+
+	b.AddHashed(1, 2)
+	inserts = b.InsertCount()
+	if inserts != 14 {
+		t.Errorf("b.InsertCount() after AddHashed() = %v, want %v", inserts, 14)
+	}
+
+	// Bits added in bulk are not inserts
+	other := New(1000, 0.01)
+	other.AddString("AnotherValue")
+	b.Union(other)
+	inserts = b.InsertCount()
+	if inserts != 14 {
+		t.Errorf("b.InsertCount() after Union() = %v, want %v", inserts, 14)
+	}
+
+	b.Clear()
+	inserts = b.InsertCount()
+	if inserts != 0 {
+		t.Errorf("b.InsertCount() after Clear() = %v, want %v", inserts, 0)
+	}
+
+	b.AddString("SomeValue")
+	b.Resize(100, 0.01)
+	inserts = b.InsertCount()
+	if inserts != 0 {
+		t.Errorf("b.InsertCount() after Resize() = %v, want %v", inserts, 0)
+	}
+}
+
+func TestResize(t *testing.T) {
+	b := New(10, 0.01)
+	b.AddString("SomeValue")
+
+	b.Resize(216553, 0.01)
+	if b.M() != 2075673 || b.K() != 7 {
+		t.Errorf("b.Resize(216553, 0.01) m, k = %v, %v, want %v, %v", b.M(), b.K(), 2075673, 7)
+	}
+	ok := b.ContainsString("SomeValue")
+	if ok {
+		t.Errorf("b.ContainsString(%q) after Resize() = %v, want %v", "SomeValue", ok, false)
+	}
+
+	b.AddString("AnotherValue")
+	ok = b.ContainsString("AnotherValue")
+	if !ok {
+		t.Errorf("b.ContainsString(%q) = %v, want %v", "AnotherValue", ok, true)
+	}
+}
+
+func TestGrowTo(t *testing.T) {
+	b := New(100, 0.01)
+	b.RetainInputs()
+	for i := 0; i < 1000; i++ {
+		b.AddString(fmt.Sprintf("value%d", i))
+	}
+
+	err := b.GrowTo(1000, 0.01)
+	if err != nil {
+		t.Fatalf("b.GrowTo(1000, 0.01) returned error: %v", err)
+	}
+	wantM, wantK := CalcOptimalMK(1000, 0.01)
+	if b.M() != wantM || b.K() != wantK {
+		t.Errorf("b.GrowTo(1000, 0.01) m, k = %v, %v, want %v, %v", b.M(), b.K(), wantM, wantK)
+	}
+	for i := 0; i < 1000; i++ {
+		value := fmt.Sprintf("value%d", i)
+		ok := b.ContainsString(value)
+		if !ok {
+			t.Errorf("b.ContainsString(%q) after GrowTo() = %v, want %v", value, ok, true)
+		}
+	}
+	rate := b.FalsePositiveRate()
+	if rate > 0.015 {
+		t.Errorf("b.FalsePositiveRate() after GrowTo() = %v, want at most %v", rate, 0.015)
+	}
+	if len(b.inputs) != 1000 {
+		t.Errorf("len(b.inputs) after GrowTo() = %v, want %v", len(b.inputs), 1000)
+	}
+}
+
+func TestGrowToWithoutRetainInputs(t *testing.T) {
+	b := New(100, 0.01)
+	b.AddString("SomeValue")
+
+	err := b.GrowTo(1000, 0.01)
+	if err == nil {
+		t.Errorf("b.GrowTo(1000, 0.01) without RetainInputs() = nil, want error")
+	}
+	ok := b.ContainsString("SomeValue")
+	if !ok {
+		t.Errorf("b.ContainsString(%q) after failed GrowTo() = %v, want %v", "SomeValue", ok, true)
+	}
+}
+
+func TestGrowToAfterResize(t *testing.T) {
+	b := New(100, 0.01)
+	b.RetainInputs()
+	b.AddString("Removed")
+	b.Resize(100, 0.01)
+	b.AddString("Kept")
+
+	if err := b.GrowTo(1000, 0.01); err != nil {
+		t.Fatalf("b.GrowTo(1000, 0.01) = %v, want nil", err)
+	}
+	if ok := b.ContainsString("Removed"); ok {
+		t.Errorf("b.ContainsString(%q) after Resize() and GrowTo() = %v, want %v", "Removed", ok, false)
+	}
+	if ok := b.ContainsString("Kept"); !ok {
+		t.Errorf("b.ContainsString(%q) after Resize() and GrowTo() = %v, want %v", "Kept", ok, true)
+	}
+}
+
+func TestGrowToAfterRemovingBits(t *testing.T) {
+	removals := map[string]func(b *BloomFilter){
+		"Intersect": func(b *BloomFilter) { _ = b.Intersect(NewMK(b.M(), b.K())) },
+		"Xor":       func(b *BloomFilter) { _ = b.Xor(b.Clone()) },
+		"ClearBit":  func(b *BloomFilter) { b.ClearBit(b.HashIndices([]byte("SomeValue"))[0]) },
+	}
+	for name, remove := range removals {
+		b := New(100, 0.01)
+		b.RetainInputs()
+		b.AddString("SomeValue")
+		remove(b)
+
+		if err := b.GrowTo(1000, 0.01); err == nil {
+			t.Errorf("b.GrowTo(1000, 0.01) after %s() = nil, want error", name)
+		}
+		if ok := b.ContainsString("SomeValue"); ok {
+			t.Errorf("b.ContainsString(%q) after %s() = %v, want %v", "SomeValue", name, ok, false)
+		}
+	}
+}
+
+func TestGrowToAfterAddingBits(t *testing.T) {
+	other := func(b *BloomFilter) *BloomFilter {
+		o := NewMK(b.M(), b.K())
+		o.AddString("Other")
+		return o
+	}
+	for _, tt := range []struct {
+		name   string
+		add    func(b *BloomFilter)
+		member []byte
+		grows  bool
+	}{
+		{"AddFields", func(b *BloomFilter) { b.AddFields([]byte("a"), []byte("bc")) }, []byte{1, 'a', 2, 'b', 'c'}, true},
+		{"AddReader", func(b *BloomFilter) { _ = b.AddReader(strings.NewReader("Other")) }, []byte("Other"), false},
+		{"AddHashed", func(b *BloomFilter) {
+			b.AddHashed(b.hash1([]byte("Other")), b.hash2([]byte("Other")))
+		}, []byte("Other"), false},
+		{"Union", func(b *BloomFilter) { _ = b.Union(other(b)) }, []byte("Other"), false},
+		{"MergeInto", func(b *BloomFilter) { _ = other(b).MergeInto(b) }, []byte("Other"), false},
+		{"UnionRawBits", func(b *BloomFilter) { _ = b.UnionRawBits(other(b).RawBits()) }, []byte("Other"), false},
+		{"UnionSerialized", func(b *BloomFilter) {
+			data, _ := other(b).MarshalBinary()
+			_ = b.UnionSerialized(data)
+		}, []byte("Other"), false},
+		{"SetBit", func(b *BloomFilter) {
+			for _, index := range b.HashIndices([]byte("Other")) {
+				b.SetBit(index)
+			}
+		}, []byte("Other"), false},
+	} {
+		b := New(100, 0.01)
+		b.RetainInputs()
+		b.AddString("SomeValue")
+		tt.add(b)
+
+		err := b.GrowTo(1000, 0.01)
+		if (err == nil) != tt.grows {
+			t.Errorf("b.GrowTo(1000, 0.01) after %s() = %v, want error: %v", tt.name, err, !tt.grows)
+		}
+		members := [][]byte{[]byte("SomeValue"), tt.member}
+		if ok := b.VerifyNoFalseNegatives(members); !ok {
+			t.Errorf("b.VerifyNoFalseNegatives() after %s() and GrowTo() = %v, want %v", tt.name, ok, true)
+		}
+	}
+}
+
+func TestClone(t *testing.T) {
+	b := NewMK(1024, 3)
+	b.AddString("SomeValue")
+
+	c := b.Clone()
+	if c.M() != b.M() || c.K() != b.K() {
+		t.Errorf("b.Clone() m, k = %v, %v, want %v, %v", c.M(), c.K(), b.M(), b.K())
+	}
+	ok := c.ContainsString("SomeValue")
+	if !ok {
+		t.Errorf("c.ContainsString(%q) = %v, want %v", "SomeValue", ok, true)
+	}
+
+	c.AddString("AnotherValue")
+	ok = b.ContainsString("AnotherValue")
+	if ok {
+		t.Errorf("b.ContainsString(%q) after adding to clone = %v, want %v", "AnotherValue", ok, false)
+	}
+
+	b.AddString("ThirdValue")
+	ok = c.ContainsString("ThirdValue")
+	if ok {
+		t.Errorf("c.ContainsString(%q) after adding to original = %v, want %v", "ThirdValue", ok, false)
+	}
+}
+
+func TestCloneOnSaturation(t *testing.T) {
+	b := NewMK(1024, 3)
+	calls := 0
+	b.OnSaturation(0, func() { calls++ })
+
+	c := b.Clone()
+	folded, _ := b.Fold()
+	combined, _ := Combine(b, NewMK(1024, 3))
+	for _, filter := range []*BloomFilter{c, folded, combined} {
+		filter.AddString("SomeValue")
+	}
+	if calls != 0 {
+		t.Errorf("OnSaturation(0) callback called %v times after adding to copies, want %v", calls, 0)
+	}
+
+	b.AddString("SomeValue")
+	if calls != 1 {
+		t.Errorf("OnSaturation(0) callback called %v times after adding to original, want %v", calls, 1)
+	}
+}
+
+func TestFold(t *testing.T) {
+	b := New(1000, 0.01)
+	if b.M()%2 != 0 {
+		b = NewMK(b.M()+1, b.K())
+	}
+	for i := 0; i < 1000; i++ {
+		b.AddString(fmt.Sprintf("value%d", i))
+	}
+
+	folded, err := b.Fold()
+	if err != nil {
+		t.Fatalf("b.Fold() returned error: %v", err)
+	}
+	if folded.M() != b.M()/2 || folded.K() != b.K() {
+		t.Errorf("b.Fold() m, k = %v, %v, want %v, %v", folded.M(), folded.K(), b.M()/2, b.K())
+	}
+	for i := 0; i < 1000; i++ {
+		value := fmt.Sprintf("value%d", i)
+		ok := folded.ContainsString(value)
+		if !ok {
+			t.Errorf("folded.ContainsString(%q) = %v, want %v", value, ok, true)
+		}
+	}
+
+	// The folded filter is the same as a filter of half the size with the same elements
+	half := NewMK(b.M()/2, b.K())
+	for i := 0; i < 1000; i++ {
+		half.AddString(fmt.Sprintf("value%d", i))
+	}
+	if !folded.Equal(half) {
+		t.Errorf("b.Fold() is not equal to a filter with m=%d and the same elements", b.M()/2)
+	}
+
+	folded.AddString("AnotherValue")
+	ok := b.ContainsString("AnotherValue")
+	if ok {
+		t.Errorf("b.ContainsString(%q) after adding to folded filter = %v, want %v", "AnotherValue", ok, false)
+	}
+}
+
+func TestFoldOdd(t *testing.T) {
+	_, err := NewMK(1001, 3).Fold()
+	if err == nil {
+		t.Errorf("NewMK(1001, 3).Fold() = nil, want error")
+	}
+}
+
+func TestEqual(t *testing.T) {
+	b := NewMK(1024, 3)
+	b.AddString("SomeValue")
+
+	c := b.Clone()
+	if !b.Equal(c) {
+		t.Errorf("b.Equal(b.Clone()) = %v, want %v", false, true)
+	}
+
+	c.AddString("AnotherValue")
+	if b.Equal(c) {
+		t.Errorf("b.Equal(c) after adding to c = %v, want %v", true, false)
+	}
+
+	for _, other := range []*BloomFilter{NewMK(1024, 4), NewMK(1023, 3)} {
+		b := NewMK(1024, 3)
+		if b.Equal(other) {
+			t.Errorf("b.Equal(m=%d, k=%d) = %v, want %v", other.m, other.k, true, false)
+		}
+	}
+}
+
+func TestForEachSetBit(t *testing.T) {
+	b := NewMK(200, 1)
+	want := []int{0, 3, 63, 64, 127, 199}
+	for _, index := range want {
+		b.bucket.set(index)
+	}
+
+	var got []int
+	b.ForEachSetBit(func(index int) bool {
+		got = append(got, index)
+		return true
+	})
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("b.ForEachSetBit() visited %v, want %v", got, want)
+	}
+
+	got = nil
+	b.ForEachSetBit(func(index int) bool {
+		got = append(got, index)
+		return len(got) < 3
+	})
+	if !reflect.DeepEqual(got, want[:3]) {
+		t.Errorf("b.ForEachSetBit() stopping after 3 bits visited %v, want %v", got, want[:3])
+	}
+}
+
+func TestSetBit(t *testing.T) {
+	b := NewMK(100, 1)
+	b.SetBit(0)
+	b.SetBit(99)
+	b.SetBit(99)
+
+	for _, tt := range []struct {
+		index int
+		want  bool
+	}{
+		{0, true},
+		{1, false},
+		{99, true},
+	} {
+		ok := b.TestBit(tt.index)
+		if ok != tt.want {
+			t.Errorf("b.TestBit(%v) = %v, want %v", tt.index, ok, tt.want)
+		}
+	}
+	if b.PopCount() != 2 {
+		t.Errorf("b.PopCount() = %v, want %v", b.PopCount(), 2)
+	}
+
+	b.ClearBit(99)
+	b.ClearBit(98)
+	ok := b.TestBit(99)
+	if ok {
+		t.Errorf("b.TestBit(%v) after ClearBit() = %v, want %v", 99, ok, false)
+	}
+	if b.PopCount() != 1 || b.setBits != 1 {
+		t.Errorf("b.PopCount(), b.setBits = %v, %v, want %v, %v", b.PopCount(), b.setBits, 1, 1)
+	}
+}
+
+func TestSetBitOutOfRange(t *testing.T) {
+	b := NewMK(100, 1)
+	for name, f := range map[string]func(){
+		"SetBit(-1)":    func() { b.SetBit(-1) },
+		"SetBit(100)":   func() { b.SetBit(100) },
+		"ClearBit(100)": func() { b.ClearBit(100) },
+		"TestBit(100)":  func() { b.TestBit(100) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("b.%s did not panic", name)
+				}
+			}()
+			f()
+		}()
+	}
+}
+
+func BenchmarkCRCHash(b *testing.B) {
+	value := []byte("value12345")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		crcHash(value)
+	}
+}
+
+func BenchmarkHashOnly(b *testing.B) {
+	filter := NewMK(2000000, 7)
+	values := make([][]byte, 1000)
+	for i := range values {
+		values[i] = []byte(fmt.Sprintf("value%d", i))
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		filter.HashOnly(values[i%len(values)])
+	}
+}
+
+func BenchmarkContainsHashed(b *testing.B) {
+	filter := NewMK(2000000, 7)
+	hashes := make([][2]uint32, 1000)
+	for i := range hashes {
+		value := []byte(fmt.Sprintf("value%d", i))
+		hashes[i][0], hashes[i][1] = filter.HashOnly(value)
+		if i%2 == 0 {
+			filter.AddBytes(value)
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h := hashes[i%len(hashes)]
+		filter.ContainsHashed(h[0], h[1])
+	}
 }
@@ -0,0 +1,100 @@
+package bloomflt
+
+import "math"
+
+// maxCount is the value at which the counters of CountingBloomFilter saturate.
+const maxCount = math.MaxUint8
+
+// CountingBloomFilter is a bloom filter that supports removal of elements.
+//
+// Instead of a single bit, every position of the filter holds an 8-bit counter, which is incremented when
+// an element is added and decremented when an element is removed. This makes the filter eight times larger
+// than a BloomFilter with the same value of m.
+//
+// Counters saturate at 255 and are never decremented once saturated, so that removing elements can not cause
+// false negatives. Elements that map only to saturated counters can not be removed from the set anymore.
+//
+// Only elements that were added to the set should be removed from it. Removing an element that was not added,
+// but is reported as present due to a false positive, would remove other elements that share its counters.
+type CountingBloomFilter struct {
+	m        int     // Number of counters
+	k        int     // Number of hash functions
+	counters []uint8 // Counter storage
+}
+
+// NewCountingMK creates a new counting bloom filter with m counters and number of hash functions equal to k.
+// Values of m less than 1 are replaced with 1.
+func NewCountingMK(m int, k int) *CountingBloomFilter {
+	if m < 1 {
+		m = 1
+	}
+	return &CountingBloomFilter{m, k, make([]uint8, m)}
+}
+
+// NewCounting creates a new counting bloom filter with optimal values of m and k for the given acceptable
+// false-positive rate (value from 0.0 to 1.0).
+func NewCounting(n int, falsePositiveRate float64) *CountingBloomFilter {
+	return NewCountingMK(usableMK(n, falsePositiveRate))
+}
+
+// AddBytes inserts a bytes value to the set
+func (c *CountingBloomFilter) AddBytes(value []byte) {
+	h1, h2 := fnvHash(value), crcHash(value)
+	for h := 0; h < c.k; h++ {
+		index := kiMiHash(h1, h2, h, c.m)
+		if c.counters[index] < maxCount {
+			c.counters[index]++
+		}
+	}
+}
+
+// AddString inserts a string value to the set
+func (c *CountingBloomFilter) AddString(value string) {
+	c.AddBytes([]byte(value))
+}
+
+// RemoveBytes removes a bytes value from the set. Values that are not in the set are ignored.
+//
+// Elements can not be enumerated from the filter, so there is no way to remove e.g. all values with a given
+// prefix: every value must be removed with exactly the same bytes it was added with.
+func (c *CountingBloomFilter) RemoveBytes(value []byte) {
+	if !c.ContainsBytes(value) {
+		return
+	}
+	h1, h2 := fnvHash(value), crcHash(value)
+	for h := 0; h < c.k; h++ {
+		index := kiMiHash(h1, h2, h, c.m)
+		if c.counters[index] > 0 && c.counters[index] < maxCount {
+			c.counters[index]--
+		}
+	}
+}
+
+// RemoveString removes a string value from the set. Values that are not in the set are ignored.
+func (c *CountingBloomFilter) RemoveString(value string) {
+	c.RemoveBytes([]byte(value))
+}
+
+// RemoveStrings removes all given string values from the set. Values that are not in the set are ignored.
+func (c *CountingBloomFilter) RemoveStrings(values ...string) {
+	for _, value := range values {
+		c.RemoveString(value)
+	}
+}
+
+// ContainsBytes tests if the set contains the given bytes value
+func (c *CountingBloomFilter) ContainsBytes(value []byte) bool {
+	h1, h2 := fnvHash(value), crcHash(value)
+	for h := 0; h < c.k; h++ {
+		index := kiMiHash(h1, h2, h, c.m)
+		if c.counters[index] == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// ContainsString tests if the set contains the given string value
+func (c *CountingBloomFilter) ContainsString(value string) bool {
+	return c.ContainsBytes([]byte(value))
+}
@@ -0,0 +1,102 @@
+package bloomflt
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCountingRemove(t *testing.T) {
+	c := NewCounting(1000, 0.01)
+	for i := 0; i < 1000; i++ {
+		c.AddString(fmt.Sprintf("value%d", i))
+	}
+
+	for i := 0; i < 1000; i += 2 {
+		c.RemoveString(fmt.Sprintf("value%d", i))
+	}
+
+	removed := 0
+	for i := 0; i < 1000; i++ {
+		value := fmt.Sprintf("value%d", i)
+		ok := c.ContainsString(value)
+		if i%2 == 1 && !ok {
+			t.Errorf("c.ContainsString(%q) = %v, want %v", value, ok, true)
+		}
+		if i%2 == 0 && !ok {
+			removed++
+		}
+	}
+	// Some removed values can still be reported as present due to false positives
+	if removed < 490 {
+		t.Errorf("%d of 500 removed values are no longer in the set, want at least %d", removed, 490)
+	}
+}
+
+func TestCountingRemoveMissing(t *testing.T) {
+	c := NewCountingMK(1024, 3)
+	c.AddString("SomeValue")
+	c.RemoveString("AnotherValue")
+
+	ok := c.ContainsString("SomeValue")
+	if !ok {
+		t.Errorf("c.ContainsString(%q) = %v, want %v", "SomeValue", ok, true)
+	}
+}
+
+func TestCountingRemoveStrings(t *testing.T) {
+	c := NewCountingMK(1024, 3)
+	c.AddString("SomeValue")
+	c.AddString("AnotherValue")
+	c.AddString("ThirdValue")
+
+	// Removing a value twice must not underflow counters shared with other values
+	c.RemoveStrings("SomeValue", "AnotherValue", "SomeValue")
+	for _, tt := range []struct {
+		value string
+		want  bool
+	}{
+		{"SomeValue", false},
+		{"AnotherValue", false},
+		{"ThirdValue", true},
+	} {
+		ok := c.ContainsString(tt.value)
+		if ok != tt.want {
+			t.Errorf("c.ContainsString(%q) = %v, want %v", tt.value, ok, tt.want)
+		}
+	}
+	for i, counter := range c.counters {
+		if counter > 1 {
+			t.Errorf("c.counters[%d] = %v, want at most %v", i, counter, 1)
+		}
+	}
+}
+
+func TestCountingSaturation(t *testing.T) {
+	c := NewCountingMK(1, 1)
+	for i := 0; i < 300; i++ {
+		c.AddString("SomeValue")
+	}
+	if c.counters[0] != maxCount {
+		t.Fatalf("c.counters[0] = %v, want %v", c.counters[0], maxCount)
+	}
+
+	// Saturated counters are never decremented
+	for i := 0; i < 300; i++ {
+		c.RemoveString("SomeValue")
+	}
+	ok := c.ContainsString("SomeValue")
+	if !ok {
+		t.Errorf("c.ContainsString(%q) = %v, want %v", "SomeValue", ok, true)
+	}
+}
+
+func TestCountingZero(t *testing.T) {
+	for _, m := range []int{0, -1} {
+		c := NewCountingMK(m, 3)
+		c.AddString("SomeValue")
+		ok := c.ContainsString("SomeValue")
+		if !ok {
+			t.Errorf("NewCountingMK(%d, 3).ContainsString(%q) = %v, want %v", m, "SomeValue", ok, true)
+		}
+	}
+}
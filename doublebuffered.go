@@ -0,0 +1,59 @@
+package bloomflt
+
+// DoubleBufferedFilter is a bloom filter for membership within a sliding time window, e.g. for "seen in the last
+// hour", whose elements expire without a gap in which recent elements are missing.
+//
+// The filter holds two BloomFilters: an active one, which is tested by the Contains methods, and a standby one.
+// Elements are added to both of them. Rotate, which should be called once per period (e.g. every hour), makes
+// the standby filter active and clears the previously active one, which becomes the standby filter. The new
+// active filter already contains every element added since the previous rotation, so an element is reported as
+// present until the second rotation after it was added, i.e. for at least one and at most two periods.
+//
+// Both filters are created with the same parameters, and should be sized for the number of elements added in
+// two periods. DoubleBufferedFilter is not safe for concurrent use by multiple goroutines.
+type DoubleBufferedFilter struct {
+	active  *BloomFilter // Filter tested by the Contains methods
+	standby *BloomFilter // Filter that becomes active after the next rotation
+}
+
+// NewDoubleBufferedMK creates a new double-buffered filter, where both filters have bucket size equal to m and
+// number of hash functions equal to k.
+func NewDoubleBufferedMK(m int, k int) *DoubleBufferedFilter {
+	return &DoubleBufferedFilter{active: NewMK(m, k), standby: NewMK(m, k)}
+}
+
+// NewDoubleBuffered creates a new double-buffered filter, where both filters have optimal values of m and k for
+// n elements and the given acceptable false-positive rate (value from 0.0 to 1.0).
+func NewDoubleBuffered(n int, falsePositiveRate float64) *DoubleBufferedFilter {
+	m, k := usableMK(n, falsePositiveRate)
+	return NewDoubleBufferedMK(m, k)
+}
+
+// AddBytes inserts a bytes value to the set
+func (d *DoubleBufferedFilter) AddBytes(value []byte) {
+	h1, h2 := d.active.HashOnly(value)
+	d.active.AddHashed(h1, h2)
+	d.standby.AddHashed(h1, h2)
+}
+
+// AddString inserts a string value to the set
+func (d *DoubleBufferedFilter) AddString(value string) {
+	d.AddBytes([]byte(value))
+}
+
+// ContainsBytes tests if the active filter contains the given bytes value
+func (d *DoubleBufferedFilter) ContainsBytes(value []byte) bool {
+	return d.active.ContainsBytes(value)
+}
+
+// ContainsString tests if the active filter contains the given string value
+func (d *DoubleBufferedFilter) ContainsString(value string) bool {
+	return d.ContainsBytes([]byte(value))
+}
+
+// Rotate makes the standby filter active and clears the previously active filter, which becomes the standby
+// filter. Elements that were not added since the previous rotation are removed from the set.
+func (d *DoubleBufferedFilter) Rotate() {
+	d.active, d.standby = d.standby, d.active
+	d.standby.Clear()
+}
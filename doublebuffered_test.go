@@ -0,0 +1,45 @@
+package bloomflt
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestDoubleBuffered(t *testing.T) {
+	d := NewDoubleBuffered(1000, 0.001)
+	for i := 0; i < 100; i++ {
+		d.AddString(fmt.Sprintf("first%d", i))
+	}
+
+	d.Rotate()
+	for i := 0; i < 100; i++ {
+		d.AddString(fmt.Sprintf("second%d", i))
+	}
+	for i := 0; i < 100; i++ {
+		for _, value := range []string{fmt.Sprintf("first%d", i), fmt.Sprintf("second%d", i)} {
+			ok := d.ContainsString(value)
+			if !ok {
+				t.Errorf("d.ContainsString(%q) after one rotation = %v, want %v", value, ok, true)
+			}
+		}
+	}
+
+	d.Rotate()
+	for i := 0; i < 100; i++ {
+		value := fmt.Sprintf("first%d", i)
+		ok := d.ContainsString(value)
+		if ok {
+			t.Errorf("d.ContainsString(%q) after two rotations = %v, want %v", value, ok, false)
+		}
+		value = fmt.Sprintf("second%d", i)
+		ok = d.ContainsString(value)
+		if !ok {
+			t.Errorf("d.ContainsString(%q) after one rotation = %v, want %v", value, ok, true)
+		}
+	}
+
+	d.Rotate()
+	if !d.active.IsEmpty() || !d.standby.IsEmpty() {
+		t.Errorf("d.Rotate() without adding elements did not empty both filters")
+	}
+}
@@ -0,0 +1,465 @@
+package bloomflt
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+)
+
+// encodingVersion is the first byte of every encoded filter. It must be bumped whenever the layout
+// below changes, so that data written by an older version can be detected.
+const encodingVersion = 1
+
+// headerSize is the size of the encoded header:
+//   - version (1 byte)
+//   - m (8 bytes, little endian)
+//   - k (8 bytes, little endian)
+//   - length of the bit storage in bytes (8 bytes, little endian)
+//
+// The header is followed by the bit storage, where byte i holds bits 8*i to 8*i+7 of the filter.
+const headerSize = 1 + 8 + 8 + 8
+
+// bucketSize returns the number of bytes needed to store m bits.
+func bucketSize(m int) int {
+	if m <= 0 {
+		return 0
+	}
+	return (m-1)/8 + 1
+}
+
+// writeChunkSize is the number of bytes of bit storage buffered by WriteTo before each write.
+const writeChunkSize = 4096
+
+// readChunkSize is the largest number of bytes of bit storage that ReadFrom allocates before reading them. The
+// size in the header can not be trusted, so the storage grows with the data that is actually read.
+const readChunkSize = 1024 * 1024
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+//
+// Only m, k and the bits of the filter are encoded. Hash functions given to NewWithHashes, the seed given
+// to NewSeeded, the byte order given to NewWithByteOrder and the domain given to NewWithDomain are not part
+// of the encoding, so such filters must be decoded into a filter created with the same hash functions, seed,
+// byte order and domain.
+func (b *BloomFilter) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Grow(headerSize + bucketSize(b.m))
+	_, err := b.WriteTo(&buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (b *BloomFilter) UnmarshalBinary(data []byte) error {
+	// Detect truncated data before ReadFrom starts reading the bit storage
+	if len(data) >= headerSize && data[0] == encodingVersion {
+		_, _, size, err := decodeHeader(data[:headerSize])
+		if err != nil {
+			return err
+		}
+		if uint64(len(data)-headerSize) < size {
+			return fmt.Errorf("bloomflt: truncated bit storage, got %d bytes, want %d", len(data)-headerSize, size)
+		}
+	}
+	_, err := b.ReadFrom(bytes.NewReader(data))
+	return err
+}
+
+// GobEncode implements the gob.GobEncoder interface. The filter is encoded in the same format as with
+// MarshalBinary.
+func (b *BloomFilter) GobEncode() ([]byte, error) {
+	return b.MarshalBinary()
+}
+
+// GobDecode implements the gob.GobDecoder interface.
+func (b *BloomFilter) GobDecode(data []byte) error {
+	return b.UnmarshalBinary(data)
+}
+
+// RawBits returns a copy of the bits of the filter as a big-endian byte slice of length ceil(m/8), where the
+// last byte holds bits 0 to 7 and the first byte holds the highest bits.
+func (b *BloomFilter) RawBits() []byte {
+	data := b.bucket.bytes(bucketSize(b.m))
+	reverseBytes(data)
+	return data
+}
+
+// SetRawBits replaces the bits of the filter with the given bits in the format returned by RawBits.
+// The length of bits must be ceil(m/8) and no bit above m can be set.
+func (b *BloomFilter) SetRawBits(bits []byte) error {
+	bucket, err := bitsetFromRawBits(b.m, bits)
+	if err != nil {
+		return err
+	}
+	b.bucket, b.stale = bucket, true
+	b.forgetInputs()
+	return nil
+}
+
+// NewFromRawBits creates a new bloom filter with bucket size equal to m and number of hash functions equal to
+// k, with the given bits in the format returned by RawBits, e.g. bits of a filter received from another system.
+// It returns an error if m or k is less than 1, or if the bits are not valid for m (see SetRawBits).
+func NewFromRawBits(m int, k int, bits []byte) (*BloomFilter, error) {
+	if m < 1 {
+		return nil, fmt.Errorf("bloomflt: invalid number of bits %d", m)
+	}
+	if k < 1 {
+		return nil, fmt.Errorf("bloomflt: invalid number of hash functions %d", k)
+	}
+	bucket, err := bitsetFromRawBits(m, bits)
+	if err != nil {
+		return nil, err
+	}
+	return &BloomFilter{m: m, k: k, bucket: bucket, stale: true}, nil
+}
+
+// UnionRawBits adds all elements of a filter with the same values of m and k to the set, given the bits of
+// that filter in the format returned by RawBits, by OR-ing them into the bits of b. The same validation as in
+// SetRawBits is applied and b is not changed if it fails.
+func (b *BloomFilter) UnionRawBits(bits []byte) error {
+	bucket, err := bitsetFromRawBits(b.m, bits)
+	if err != nil {
+		return err
+	}
+	for i, word := range bucket {
+		b.bucket[i] |= word
+	}
+	b.stale = true
+	b.forgetInputs()
+	return nil
+}
+
+// UnionSerialized adds all elements of a filter encoded with MarshalBinary (or WriteTo) to the set, by OR-ing
+// its bits into the bits of b directly from data, without decoding it into a new filter first. This avoids
+// allocations when combining many encoded filters, e.g. of shards sent over the network.
+//
+// The encoded filter must have the same values of m and k as b, otherwise an error wrapping
+// ErrIncompatibleParams is returned. Errors are also returned for data that is not a complete encoded filter.
+// In both cases b is not changed.
+func (b *BloomFilter) UnionSerialized(data []byte) error {
+	if len(data) < headerSize {
+		return fmt.Errorf("bloomflt: truncated header, got %d bytes, want %d", len(data), headerSize)
+	}
+	if data[0] != encodingVersion {
+		return fmt.Errorf("bloomflt: unknown encoding version %d", data[0])
+	}
+	m, k, size, err := decodeHeader(data[:headerSize])
+	if err != nil {
+		return err
+	}
+	if m != b.m || k != b.k {
+		return fmt.Errorf("%w: m=%d, k=%d and m=%d, k=%d", ErrIncompatibleParams, b.m, b.k, m, k)
+	}
+	bits := data[headerSize:]
+	if uint64(len(bits)) != size {
+		return fmt.Errorf("bloomflt: got %d bytes of bit storage, want %d", len(bits), size)
+	}
+	if m%8 != 0 && bits[size-1]>>uint(m%8) != 0 {
+		return fmt.Errorf("bloomflt: bits above bit %d are set", m-1)
+	}
+
+	for i, value := range bits {
+		b.bucket[i/8] |= uint64(value) << uint(i%8*8)
+	}
+	b.stale = true
+	b.forgetInputs()
+	return nil
+}
+
+// bitsetFromRawBits validates bits in the format returned by RawBits and creates a bitset of m bits from them.
+func bitsetFromRawBits(m int, bits []byte) (bitset, error) {
+	size := bucketSize(m)
+	if len(bits) != size {
+		return nil, fmt.Errorf("bloomflt: got %d bytes of bits, want %d for %d bits", len(bits), size, m)
+	}
+	if m%8 != 0 && size > 0 && bits[0]>>uint(m%8) != 0 {
+		return nil, fmt.Errorf("bloomflt: bits above bit %d are set", m-1)
+	}
+
+	data := make([]byte, size)
+	copy(data, bits)
+	reverseBytes(data)
+	return bitsetFromBytes(m, data), nil
+}
+
+// reverseBytes reverses the order of the bytes in the given slice in place.
+func reverseBytes(s []byte) {
+	for i, j := 0, len(s)-1; i < j; i, j = i+1, j-1 {
+		s[i], s[j] = s[j], s[i]
+	}
+}
+
+// jsonFilter is the JSON representation of a filter. Bits are stored in the same format as in the binary
+// encoding and are encoded as base64 string.
+type jsonFilter struct {
+	M    int    `json:"m"`
+	K    int    `json:"k"`
+	Bits []byte `json:"bits"`
+}
+
+// MarshalJSON implements the json.Marshaler interface. The filter is encoded as an object with the values
+// of m and k and the bits of the filter as base64 string.
+func (b *BloomFilter) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonFilter{b.m, b.k, b.bucket.bytes(bucketSize(b.m))})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface. The hash functions and seed of b are kept.
+func (b *BloomFilter) UnmarshalJSON(data []byte) error {
+	var filter jsonFilter
+	err := json.Unmarshal(data, &filter)
+	if err != nil {
+		return err
+	}
+	if filter.M < 1 {
+		return fmt.Errorf("bloomflt: invalid number of bits %d", filter.M)
+	}
+	if filter.K < 0 {
+		return fmt.Errorf("bloomflt: invalid number of hash functions %d", filter.K)
+	}
+	if len(filter.Bits) != bucketSize(filter.M) {
+		return fmt.Errorf("bloomflt: bit storage of %d bytes does not match %d bits", len(filter.Bits), filter.M)
+	}
+	if filter.M%8 != 0 && filter.Bits[len(filter.Bits)-1]>>uint(filter.M%8) != 0 {
+		return fmt.Errorf("bloomflt: bits above bit %d are set", filter.M-1)
+	}
+
+	b.m, b.k, b.bucket = filter.M, filter.K, bitsetFromBytes(filter.M, filter.Bits)
+	b.stale = true
+	b.forgetInputs()
+	return nil
+}
+
+// WriteTo implements the io.WriterTo interface. It writes the filter in the same format as MarshalBinary,
+// without building the whole encoded filter in memory first.
+func (b *BloomFilter) WriteTo(w io.Writer) (int64, error) {
+	var header [headerSize]byte
+	header[0] = encodingVersion
+	size := bucketSize(b.m)
+	binary.LittleEndian.PutUint64(header[1:], uint64(b.m))
+	binary.LittleEndian.PutUint64(header[9:], uint64(b.k))
+	binary.LittleEndian.PutUint64(header[17:], uint64(size))
+
+	n, err := w.Write(header[:])
+	written := int64(n)
+	if err != nil {
+		return written, err
+	}
+
+	chunk := make([]byte, 0, writeChunkSize)
+	for i := 0; i < size; i++ {
+		chunk = append(chunk, b.bucket.byteAt(i))
+
+		if len(chunk) == cap(chunk) || i == size-1 {
+			n, err = w.Write(chunk)
+			written += int64(n)
+			if err != nil {
+				return written, err
+			}
+			chunk = chunk[:0]
+		}
+	}
+
+	return written, nil
+}
+
+// ReadFrom implements the io.ReaderFrom interface. It reads a filter in the format written by WriteTo or
+// MarshalBinary and replaces the contents of b with it. The hash functions and seed of b are kept.
+func (b *BloomFilter) ReadFrom(r io.Reader) (int64, error) {
+	var header [headerSize]byte
+	n, err := io.ReadFull(r, header[:1])
+	read := int64(n)
+	if err != nil {
+		return read, fmt.Errorf("bloomflt: truncated data, missing encoding version: %v", err)
+	}
+	if header[0] != encodingVersion {
+		return read, fmt.Errorf("bloomflt: unknown encoding version %d", header[0])
+	}
+
+	n, err = io.ReadFull(r, header[1:])
+	read += int64(n)
+	if err != nil {
+		return read, fmt.Errorf("bloomflt: truncated header: %v", err)
+	}
+
+	m, k, size, err := decodeHeader(header[:])
+	if err != nil {
+		return read, err
+	}
+
+	data := make([]byte, 0, min(size, readChunkSize))
+	for uint64(len(data)) < size {
+		start := len(data)
+		data = append(data, make([]byte, min(size-uint64(start), readChunkSize))...)
+		n, err = io.ReadFull(r, data[start:])
+		read += int64(n)
+		if err != nil {
+			return read, fmt.Errorf("bloomflt: truncated bit storage: %v", err)
+		}
+	}
+	if m%8 != 0 && data[size-1]>>uint(m%8) != 0 {
+		return read, fmt.Errorf("bloomflt: bits above bit %d are set", m-1)
+	}
+
+	b.m, b.k, b.bucket = m, k, bitsetFromBytes(m, data)
+	b.stale = true
+	b.forgetInputs()
+
+	return read, nil
+}
+
+// WriteCompressed writes the filter in the format of WriteTo, compressed with DEFLATE at the given level
+// (from flate.HuffmanOnly to flate.BestCompression). Sparse filters compress very well.
+func (b *BloomFilter) WriteCompressed(w io.Writer, level int) error {
+	fw, err := flate.NewWriter(w, level)
+	if err != nil {
+		return err
+	}
+	_, err = b.WriteTo(fw)
+	if err != nil {
+		return err
+	}
+	return fw.Close()
+}
+
+// ReadCompressed reads a filter written by WriteCompressed and replaces the contents of b with it. The hash
+// functions and seed of b are kept.
+//
+// If r does not implement io.ByteReader, data after the end of the compressed filter may be consumed from it.
+func (b *BloomFilter) ReadCompressed(r io.Reader) error {
+	fr := flate.NewReader(r)
+	_, err := b.ReadFrom(fr)
+	if err != nil {
+		return err
+	}
+	return fr.Close()
+}
+
+// Formats of the data written by ExportSparse, stored in its first byte.
+const (
+	sparseFormatDense  = 0 // Bits stored like in MarshalBinary, one bit per position
+	sparseFormatSparse = 1 // Positions of the set bits stored as deltas
+)
+
+// ExportSparse encodes the filter in a format that is much smaller than MarshalBinary for filters with few set
+// bits, e.g. filters created for many more elements than added to them. The encoded filter can be decoded with
+// ImportSparse.
+//
+// The data starts with a byte for the format, followed by m and k as uvarints (see binary.PutUvarint). In the
+// sparse format, the rest of the data is the positions of the set bits in increasing order, each encoded as the
+// number of unset bits since the previous set bit (or since the start) as uvarint. When that takes as many bytes
+// as the bits themselves, the filter is encoded in the dense format instead, with the bits stored like in
+// MarshalBinary. The smaller format is always chosen, so the data is never more than a few bytes larger than the
+// bits of the filter. Like with MarshalBinary, the hash functions of the filter are not part of the encoding.
+func (b *BloomFilter) ExportSparse() ([]byte, error) {
+	header := []byte{sparseFormatSparse}
+	header = binary.AppendUvarint(header, uint64(b.m))
+	header = binary.AppendUvarint(header, uint64(b.k))
+
+	size := bucketSize(b.m)
+	data := header
+	previous := -1
+	b.bucket.forEach(func(index int) bool {
+		data = binary.AppendUvarint(data, uint64(index-previous-1))
+		previous = index
+		// Stop as soon as the dense format is known to be smaller
+		return len(data)-len(header) < size
+	})
+	if len(data)-len(header) < size {
+		return data, nil
+	}
+
+	data = append(data[:len(header)], b.bucket.bytes(size)...)
+	data[0] = sparseFormatDense
+	return data, nil
+}
+
+// ImportSparse decodes a filter encoded with ExportSparse, in either of its formats, and replaces the contents of
+// b with it. The hash functions and seed of b are kept. An error is returned for invalid data, in which case b is
+// not changed.
+//
+// In the sparse format, a few bytes can describe a filter with any number of bits, so filters with more bits than
+// New can create (2^32 on 64-bit platforms, see New) are rejected, instead of allocating their bit storage. Such
+// filters can still be decoded from the dense format, whose size matches the number of bits.
+func (b *BloomFilter) ImportSparse(data []byte) error {
+	if len(data) < 1 {
+		return fmt.Errorf("bloomflt: truncated data, missing sparse format")
+	}
+	format := data[0]
+	m, n := binary.Uvarint(data[1:])
+	if n <= 0 {
+		return fmt.Errorf("bloomflt: truncated or invalid number of bits")
+	}
+	k, n2 := binary.Uvarint(data[1+n:])
+	if n2 <= 0 {
+		return fmt.Errorf("bloomflt: truncated or invalid number of hash functions")
+	}
+	if m < 1 || m > maxBits {
+		return fmt.Errorf("bloomflt: invalid number of bits %d", m)
+	}
+	if k > math.MaxInt32 {
+		return fmt.Errorf("bloomflt: invalid number of hash functions %d", k)
+	}
+	payload := data[1+n+n2:]
+
+	var bucket bitset
+	switch format {
+	case sparseFormatDense:
+		size := bucketSize(int(m))
+		if len(payload) != size {
+			return fmt.Errorf("bloomflt: bit storage of %d bytes does not match %d bits", len(payload), m)
+		}
+		if m%8 != 0 && payload[size-1]>>uint(m%8) != 0 {
+			return fmt.Errorf("bloomflt: bits above bit %d are set", m-1)
+		}
+		bucket = bitsetFromBytes(int(m), payload)
+	case sparseFormatSparse:
+		if m > maxAllocBits {
+			return fmt.Errorf("bloomflt: %d bits in sparse format exceed the maximum of %d", m, uint64(maxAllocBits))
+		}
+		bucket = newBitset(int(m))
+		// The number of positions that are still free after the previous set bit
+		remaining := m
+		for len(payload) > 0 {
+			delta, n := binary.Uvarint(payload)
+			if n <= 0 {
+				return fmt.Errorf("bloomflt: truncated or invalid position of a set bit")
+			}
+			if delta >= remaining {
+				return fmt.Errorf("bloomflt: position of a set bit is out of range [0, %d)", m)
+			}
+			remaining -= delta + 1
+			bucket.set(int(m - remaining - 1))
+			payload = payload[n:]
+		}
+	default:
+		return fmt.Errorf("bloomflt: unknown sparse format %d", format)
+	}
+
+	b.m, b.k, b.bucket = int(m), int(k), bucket
+	b.stale = true
+	b.forgetInputs()
+	return nil
+}
+
+// decodeHeader validates the values stored in an encoded header and returns m, k and the size of the
+// bit storage in bytes.
+func decodeHeader(header []byte) (int, int, uint64, error) {
+	m := binary.LittleEndian.Uint64(header[1:])
+	k := binary.LittleEndian.Uint64(header[9:])
+	size := binary.LittleEndian.Uint64(header[17:])
+	if m < 1 || m > maxBits {
+		return 0, 0, 0, fmt.Errorf("bloomflt: invalid number of bits %d", m)
+	}
+	if k > math.MaxInt32 {
+		return 0, 0, 0, fmt.Errorf("bloomflt: invalid number of hash functions %d", k)
+	}
+	if size != uint64(bucketSize(int(m))) {
+		return 0, 0, 0, fmt.Errorf("bloomflt: bit storage of %d bytes does not match %d bits", size, m)
+	}
+	return int(m), int(k), size, nil
+}
@@ -0,0 +1,570 @@
+package bloomflt
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/adler32"
+	"hash/fnv"
+	"testing"
+	"testing/iotest"
+)
+
+func TestMarshalBinary(t *testing.T) {
+	b := New(100, 0.01)
+	for i := 0; i < 100; i++ {
+		b.AddString(fmt.Sprintf("value%d", i))
+	}
+
+	data, err := b.MarshalBinary()
+	if err != nil {
+		t.Fatalf("b.MarshalBinary() returned error: %v", err)
+	}
+
+	got := &BloomFilter{}
+	err = got.UnmarshalBinary(data)
+	if err != nil {
+		t.Fatalf("got.UnmarshalBinary() returned error: %v", err)
+	}
+
+	if !got.Equal(b) {
+		t.Errorf("got.UnmarshalBinary() did not restore an equal filter")
+	}
+	for i := 0; i < 1000; i++ {
+		value := []byte(fmt.Sprintf("value%d", i))
+		want := b.ContainsBytes(value)
+		ok := got.ContainsBytes(value)
+		if ok != want {
+			t.Errorf("got.ContainsBytes(%q) = %v, want %v", value, ok, want)
+		}
+	}
+}
+
+func TestUnmarshalBinaryKeepsHashes(t *testing.T) {
+	b := NewWithHashes(1024, 3, fnv.New32, adler32.New)
+	b.AddString("SomeValue")
+	data, _ := b.MarshalBinary()
+
+	got := NewWithHashes(1, 1, fnv.New32, adler32.New)
+	err := got.UnmarshalBinary(data)
+	if err != nil {
+		t.Fatalf("got.UnmarshalBinary() returned error: %v", err)
+	}
+	ok := got.ContainsString("SomeValue")
+	if !ok {
+		t.Errorf("got.ContainsString(%q) = %v, want %v", "SomeValue", ok, true)
+	}
+}
+
+func TestUnmarshalBinaryUnknownVersion(t *testing.T) {
+	data, _ := NewMK(64, 2).MarshalBinary()
+	data[0] = 255
+
+	err := (&BloomFilter{}).UnmarshalBinary(data)
+	if err == nil {
+		t.Errorf("UnmarshalBinary() with unknown version = nil, want error")
+	}
+}
+
+func TestUnmarshalBinaryTruncated(t *testing.T) {
+	b := NewMK(64, 2)
+	b.AddString("SomeValue")
+	data, _ := b.MarshalBinary()
+
+	for _, n := range []int{0, 1, headerSize - 1, headerSize, len(data) - 1} {
+		err := (&BloomFilter{}).UnmarshalBinary(data[:n])
+		if err == nil {
+			t.Errorf("UnmarshalBinary(data[:%d]) = nil, want error", n)
+		}
+	}
+}
+
+func TestUnmarshalBinaryHugeTruncated(t *testing.T) {
+	// A header of a filter with 2^50 bits, without the bit storage
+	m := uint64(1) << 50
+	data := make([]byte, headerSize)
+	data[0] = encodingVersion
+	binary.LittleEndian.PutUint64(data[1:], m)
+	binary.LittleEndian.PutUint64(data[9:], 7)
+	binary.LittleEndian.PutUint64(data[17:], m/8)
+
+	err := (&BloomFilter{}).UnmarshalBinary(data)
+	if err == nil {
+		t.Errorf("UnmarshalBinary() of header with m=%d and no bits = nil, want error", m)
+	}
+	read, err := (&BloomFilter{}).ReadFrom(bytes.NewReader(data))
+	if err == nil {
+		t.Errorf("ReadFrom() of header with m=%d and no bits = nil, want error", m)
+	}
+	if read != headerSize {
+		t.Errorf("ReadFrom() of header with m=%d and no bits = %v, want %v", m, read, headerSize)
+	}
+}
+
+func TestWriteToReadFrom(t *testing.T) {
+	b := New(10000, 0.01)
+	for i := 0; i < 10000; i++ {
+		b.AddString(fmt.Sprintf("value%d", i))
+	}
+
+	var buf bytes.Buffer
+	written, err := b.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("b.WriteTo() returned error: %v", err)
+	}
+	if written != int64(buf.Len()) {
+		t.Errorf("b.WriteTo() = %v, want %v", written, buf.Len())
+	}
+
+	data, _ := b.MarshalBinary()
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Errorf("b.WriteTo() wrote different data than b.MarshalBinary()")
+	}
+
+	// Force partial reads to make sure ReadFrom keeps reading until it has all data
+	got := &BloomFilter{}
+	read, err := got.ReadFrom(iotest.OneByteReader(bytes.NewReader(buf.Bytes())))
+	if err != nil {
+		t.Fatalf("got.ReadFrom() returned error: %v", err)
+	}
+	if read != written {
+		t.Errorf("got.ReadFrom() = %v, want %v", read, written)
+	}
+
+	for i := 0; i < 20000; i++ {
+		value := fmt.Sprintf("value%d", i)
+		want := b.ContainsString(value)
+		ok := got.ContainsString(value)
+		if ok != want {
+			t.Errorf("got.ContainsString(%q) = %v, want %v", value, ok, want)
+		}
+	}
+}
+
+func TestReadFromLarge(t *testing.T) {
+	// The bit storage is read in several chunks
+	b := NewMK(2*readChunkSize*8+100, 3)
+	for i := 0; i < 1000; i++ {
+		b.AddString(fmt.Sprintf("value%d", i))
+	}
+	data, _ := b.MarshalBinary()
+
+	got := &BloomFilter{}
+	read, err := got.ReadFrom(iotest.HalfReader(bytes.NewReader(data)))
+	if err != nil {
+		t.Fatalf("got.ReadFrom() returned error: %v", err)
+	}
+	if read != int64(len(data)) {
+		t.Errorf("got.ReadFrom() = %v, want %v", read, len(data))
+	}
+	if !got.Equal(b) {
+		t.Errorf("got.ReadFrom() did not restore an equal filter")
+	}
+}
+
+func TestReadFromTruncated(t *testing.T) {
+	data, _ := NewMK(64, 2).MarshalBinary()
+
+	read, err := (&BloomFilter{}).ReadFrom(bytes.NewReader(data[:len(data)-1]))
+	if err == nil {
+		t.Errorf("ReadFrom() of truncated data = nil, want error")
+	}
+	if read != int64(len(data)-1) {
+		t.Errorf("ReadFrom() of truncated data = %v, want %v", read, len(data)-1)
+	}
+}
+
+func TestUnmarshalBinaryPaddingBits(t *testing.T) {
+	// With m=10, only the lowest 2 bits of the last byte are used
+	data, _ := NewMK(10, 3).MarshalBinary()
+	data[len(data)-1] = 0xff
+
+	err := (&BloomFilter{}).UnmarshalBinary(data)
+	if err == nil {
+		t.Errorf("UnmarshalBinary() with bits above m set = nil, want error")
+	}
+	_, err = (&BloomFilter{}).ReadFrom(bytes.NewReader(data))
+	if err == nil {
+		t.Errorf("ReadFrom() with bits above m set = nil, want error")
+	}
+	err = (&BloomFilter{}).GobDecode(data)
+	if err == nil {
+		t.Errorf("GobDecode() with bits above m set = nil, want error")
+	}
+}
+
+func TestGob(t *testing.T) {
+	type message struct {
+		Name   string
+		Filter *BloomFilter
+	}
+
+	b := New(100, 0.01)
+	for i := 0; i < 100; i++ {
+		b.AddString(fmt.Sprintf("value%d", i))
+	}
+
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(message{"filter", b})
+	if err != nil {
+		t.Fatalf("gob Encode() returned error: %v", err)
+	}
+
+	var got message
+	err = gob.NewDecoder(&buf).Decode(&got)
+	if err != nil {
+		t.Fatalf("gob Decode() returned error: %v", err)
+	}
+
+	if !got.Filter.Equal(b) {
+		t.Errorf("gob Decode() did not restore an equal filter")
+	}
+	for i := 0; i < 200; i++ {
+		value := fmt.Sprintf("value%d", i)
+		want := b.ContainsString(value)
+		ok := got.Filter.ContainsString(value)
+		if ok != want {
+			t.Errorf("got.Filter.ContainsString(%q) = %v, want %v", value, ok, want)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	b := New(100, 0.01)
+	for i := 0; i < 100; i++ {
+		b.AddString(fmt.Sprintf("value%d", i))
+	}
+
+	data, err := json.Marshal(b)
+	if err != nil {
+		t.Fatalf("json.Marshal(b) returned error: %v", err)
+	}
+
+	got := &BloomFilter{}
+	err = json.Unmarshal(data, got)
+	if err != nil {
+		t.Fatalf("json.Unmarshal() returned error: %v", err)
+	}
+
+	if !got.Equal(b) {
+		t.Errorf("json.Unmarshal() did not restore an equal filter")
+	}
+	for i := 0; i < 200; i++ {
+		value := fmt.Sprintf("value%d", i)
+		want := b.ContainsString(value)
+		ok := got.ContainsString(value)
+		if ok != want {
+			t.Errorf("got.ContainsString(%q) = %v, want %v", value, ok, want)
+		}
+	}
+}
+
+func TestUnmarshalJSONInvalid(t *testing.T) {
+	for _, data := range []string{
+		`{"m": 64, "k": 2, "bits": "AAAAAAAAAAA="`,
+		`{"m": -1, "k": 2, "bits": ""}`,
+		`{"m": 64, "k": -2, "bits": "AAAAAAAAAAA="}`,
+		`{"m": 64, "k": 2, "bits": "AAAA"}`,
+		`{"m": 64, "k": 2, "bits": "not base64"}`,
+		`{"m": 10, "k": 3, "bits": "AP8="}`,
+	} {
+		err := (&BloomFilter{}).UnmarshalJSON([]byte(data))
+		if err == nil {
+			t.Errorf("UnmarshalJSON(%s) = nil, want error", data)
+		}
+	}
+}
+
+func TestRawBits(t *testing.T) {
+	b := NewMK(12, 1)
+	b.bucket.set(0)
+	b.bucket.set(9)
+
+	got := b.RawBits()
+	want := []byte{0x02, 0x01}
+	if !bytes.Equal(got, want) {
+		t.Errorf("b.RawBits() = %v, want %v", got, want)
+	}
+
+	c := NewMK(12, 1)
+	err := c.SetRawBits(got)
+	if err != nil {
+		t.Fatalf("c.SetRawBits(%v) returned error: %v", got, err)
+	}
+	if !c.Equal(b) {
+		t.Errorf("c.SetRawBits(%v) did not restore an equal filter", got)
+	}
+}
+
+func TestSetRawBitsInvalid(t *testing.T) {
+	b := NewMK(12, 1)
+	for _, bits := range [][]byte{
+		nil,
+		{0x01},
+		{0x00, 0x00, 0x00},
+		{0x10, 0x00},
+	} {
+		err := b.SetRawBits(bits)
+		if err == nil {
+			t.Errorf("b.SetRawBits(%v) = nil, want error", bits)
+		}
+	}
+}
+
+func TestNewFromRawBits(t *testing.T) {
+	b := New(100, 0.01)
+	b.AddString("SomeValue")
+
+	got, err := NewFromRawBits(b.M(), b.K(), b.RawBits())
+	if err != nil {
+		t.Fatalf("NewFromRawBits() returned error: %v", err)
+	}
+	if !got.Equal(b) {
+		t.Errorf("NewFromRawBits() did not create an equal filter")
+	}
+	ok := got.ContainsString("SomeValue")
+	if !ok {
+		t.Errorf("got.ContainsString(%q) = %v, want %v", "SomeValue", ok, true)
+	}
+
+	for _, tt := range []struct {
+		m, k int
+		bits []byte
+	}{
+		{0, 1, nil},
+		{12, 0, []byte{0x00, 0x00}},
+		{12, 1, []byte{0x00}},
+		{12, 1, []byte{0x10, 0x00}},
+	} {
+		_, err = NewFromRawBits(tt.m, tt.k, tt.bits)
+		if err == nil {
+			t.Errorf("NewFromRawBits(%v, %v, %v) = nil, want error", tt.m, tt.k, tt.bits)
+		}
+	}
+}
+
+func TestUnionRawBits(t *testing.T) {
+	b := New(100, 0.01)
+	other := New(100, 0.01)
+	b.AddString("SomeValue")
+	other.AddString("AnotherValue")
+
+	err := b.UnionRawBits(other.RawBits())
+	if err != nil {
+		t.Fatalf("b.UnionRawBits() returned error: %v", err)
+	}
+	for _, value := range []string{"SomeValue", "AnotherValue"} {
+		ok := b.ContainsString(value)
+		if !ok {
+			t.Errorf("b.ContainsString(%q) = %v, want %v", value, ok, true)
+		}
+	}
+
+	before := b.Clone()
+	err = b.UnionRawBits(other.RawBits()[1:])
+	if err == nil {
+		t.Errorf("b.UnionRawBits() with short bits = nil, want error")
+	}
+	if !b.Equal(before) {
+		t.Errorf("b.UnionRawBits() with short bits changed the filter")
+	}
+}
+
+func TestUnionSerialized(t *testing.T) {
+	b := New(100, 0.01)
+	b.AddString("SomeValue")
+	var shards [][]byte
+	for i := 0; i < 10; i++ {
+		shard := New(100, 0.01)
+		shard.AddString(fmt.Sprintf("value%d", i))
+		data, _ := shard.MarshalBinary()
+		shards = append(shards, data)
+	}
+
+	want := b.Clone()
+	for _, data := range shards {
+		err := b.UnionSerialized(data)
+		if err != nil {
+			t.Fatalf("b.UnionSerialized() returned error: %v", err)
+		}
+		other := &BloomFilter{}
+		other.UnmarshalBinary(data)
+		want.Union(other)
+	}
+	if !b.Equal(want) {
+		t.Errorf("b.UnionSerialized() did not produce the same filter as Union")
+	}
+	if b.PopCount() != want.PopCount() {
+		t.Errorf("b.PopCount() after UnionSerialized = %v, want %v", b.PopCount(), want.PopCount())
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		b.UnionSerialized(shards[0])
+	})
+	if allocs != 0 {
+		t.Errorf("b.UnionSerialized() allocated %v times, want 0", allocs)
+	}
+}
+
+func TestUnionSerializedInvalid(t *testing.T) {
+	b := New(100, 0.01)
+	data, _ := New(100, 0.01).MarshalBinary()
+	incompatible, _ := NewMK(64, 2).MarshalBinary()
+	unknown := append([]byte{}, data...)
+	unknown[0] = 255
+	padding := append([]byte{}, data...)
+	padding[len(padding)-1] = 0x80
+
+	before := b.Clone()
+	for _, tt := range []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"truncated header", data[:headerSize-1]},
+		{"truncated bits", data[:len(data)-1]},
+		{"trailing data", append(append([]byte{}, data...), 0)},
+		{"unknown version", unknown},
+		{"incompatible", incompatible},
+		{"bits above m", padding},
+	} {
+		err := b.UnionSerialized(tt.data)
+		if err == nil {
+			t.Errorf("b.UnionSerialized() with %s data = nil, want error", tt.name)
+		}
+	}
+	if !b.Equal(before) {
+		t.Errorf("b.UnionSerialized() with invalid data changed the filter")
+	}
+
+	err := b.UnionSerialized(incompatible)
+	if !errors.Is(err, ErrIncompatibleParams) {
+		t.Errorf("b.UnionSerialized(m=64, k=2) = %v, want %v", err, ErrIncompatibleParams)
+	}
+}
+
+func TestCompressed(t *testing.T) {
+	b := NewMK(2000000, 7)
+	for i := 0; i < 1000; i++ {
+		b.AddString(fmt.Sprintf("value%d", i))
+	}
+
+	var buf bytes.Buffer
+	err := b.WriteCompressed(&buf, flate.BestCompression)
+	if err != nil {
+		t.Fatalf("b.WriteCompressed() returned error: %v", err)
+	}
+	raw := headerSize + bucketSize(b.m)
+	if buf.Len() > raw/10 {
+		t.Errorf("b.WriteCompressed() wrote %d bytes, want at most %d", buf.Len(), raw/10)
+	}
+
+	got := &BloomFilter{}
+	err = got.ReadCompressed(&buf)
+	if err != nil {
+		t.Fatalf("got.ReadCompressed() returned error: %v", err)
+	}
+	if !got.Equal(b) {
+		t.Errorf("got.ReadCompressed() did not restore an equal filter")
+	}
+}
+
+func TestSparse(t *testing.T) {
+	sparse := NewMK(2000000, 7)
+	for i := 0; i < 1000; i++ {
+		sparse.AddString(fmt.Sprintf("value%d", i))
+	}
+	dense := NewMK(1000, 7)
+	for i := 0; i < 1000; i++ {
+		dense.AddString(fmt.Sprintf("value%d", i))
+	}
+
+	for _, tt := range []struct {
+		name       string
+		b          *BloomFilter
+		wantFormat byte
+	}{
+		{"sparse", sparse, sparseFormatSparse},
+		{"dense", dense, sparseFormatDense},
+		{"empty", NewMK(1000, 7), sparseFormatSparse},
+		{"one bit", NewMK(1, 1), sparseFormatSparse},
+	} {
+		data, err := tt.b.ExportSparse()
+		if err != nil {
+			t.Fatalf("%s filter ExportSparse() returned error: %v", tt.name, err)
+		}
+		if data[0] != tt.wantFormat {
+			t.Errorf("%s filter ExportSparse() used format %d, want %d", tt.name, data[0], tt.wantFormat)
+		}
+		if len(data) > bucketSize(tt.b.M())+1+2*binary.MaxVarintLen64 {
+			t.Errorf("%s filter ExportSparse() wrote %d bytes, want at most the size of the bits", tt.name, len(data))
+		}
+
+		got := NewMK(1, 1)
+		err = got.ImportSparse(data)
+		if err != nil {
+			t.Fatalf("%s filter ImportSparse() returned error: %v", tt.name, err)
+		}
+		if !got.Equal(tt.b) {
+			t.Errorf("%s filter ImportSparse() did not restore an equal filter", tt.name)
+		}
+	}
+
+	data, _ := sparse.ExportSparse()
+	if len(data) > bucketSize(sparse.M())/10 {
+		t.Errorf("sparse filter ExportSparse() wrote %d bytes, want at most %d", len(data), bucketSize(sparse.M())/10)
+	}
+}
+
+func TestImportSparseInvalid(t *testing.T) {
+	b := NewMK(12, 1)
+	b.SetBit(3)
+	b.SetBit(11)
+	sparse, _ := b.ExportSparse()
+	dense := append([]byte{sparseFormatDense}, sparse[1:3]...)
+	dense = append(dense, b.bucket.bytes(2)...)
+
+	before := b.Clone()
+	for _, data := range [][]byte{
+		nil,
+		{sparseFormatSparse},
+		{sparseFormatSparse, 12},
+		{sparseFormatSparse, 0, 1},
+		{sparseFormatSparse, 12, 1, 12},
+		{sparseFormatSparse, 12, 1, 3, 7, 0},
+		{sparseFormatSparse, 12, 1, 0x80},
+		{sparseFormatSparse, 12, 1, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01},
+		{sparseFormatDense, 12, 1, 0x08},
+		{sparseFormatDense, 12, 1, 0x08, 0x18},
+		{2, 12, 1},
+		// m = 2^62
+		{sparseFormatSparse, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x40, 1},
+		// m = 2^32 + 1
+		{sparseFormatSparse, 0x81, 0x80, 0x80, 0x80, 0x10, 1},
+	} {
+		err := b.ImportSparse(data)
+		if err == nil {
+			t.Errorf("b.ImportSparse(%v) = nil, want error", data)
+		}
+	}
+	if !b.Equal(before) {
+		t.Errorf("b.ImportSparse() with invalid data changed the filter")
+	}
+
+	err := b.ImportSparse(dense)
+	if err != nil || !b.Equal(before) {
+		t.Errorf("b.ImportSparse(%v) = %v, want filter with bits 3 and 11", dense, err)
+	}
+}
+
+func TestWriteCompressedInvalidLevel(t *testing.T) {
+	var buf bytes.Buffer
+	err := NewMK(64, 2).WriteCompressed(&buf, 100)
+	if err == nil {
+		t.Errorf("WriteCompressed() with level 100 = nil, want error")
+	}
+}
@@ -0,0 +1,52 @@
+package bloomflt
+
+// FilterSet is a collection of bloom filters identified by string namespaces, e.g. one filter per tenant or per
+// type of key, accessed through a single object.
+//
+// Each namespace has its own filter, created on first use with the parameters given to the constructor of the
+// set, so values of different namespaces never share bits and the false positives of a namespace depend only on
+// the number of elements added to it. The same value can be added to one namespace and be missing from another.
+//
+// FilterSet is not safe for concurrent use by multiple goroutines.
+type FilterSet struct {
+	m       int                     // Number of bits of each filter
+	k       int                     // Number of hash functions of each filter
+	filters map[string]*BloomFilter // Filters of the namespaces used so far
+}
+
+// NewFilterSetMK creates a new empty set of filters, where the filter of each namespace has bucket size equal to m
+// and number of hash functions equal to k.
+func NewFilterSetMK(m int, k int) *FilterSet {
+	return &FilterSet{m: m, k: k, filters: make(map[string]*BloomFilter)}
+}
+
+// NewFilterSet creates a new empty set of filters, where the filter of each namespace has optimal values of m and
+// k for n elements and the given acceptable false-positive rate (value from 0.0 to 1.0).
+func NewFilterSet(n int, falsePositiveRate float64) *FilterSet {
+	m, k := usableMK(n, falsePositiveRate)
+	return NewFilterSetMK(m, k)
+}
+
+// AddNamespaced inserts a bytes value to the filter of the given namespace, creating the filter if the namespace
+// was not used before.
+func (f *FilterSet) AddNamespaced(ns string, value []byte) {
+	filter, ok := f.filters[ns]
+	if !ok {
+		filter = NewMK(f.m, f.k)
+		f.filters[ns] = filter
+	}
+	filter.AddBytes(value)
+}
+
+// ContainsNamespaced tests if the filter of the given namespace contains the given bytes value. It returns false
+// if nothing was added to the namespace, without creating a filter for it.
+func (f *FilterSet) ContainsNamespaced(ns string, value []byte) bool {
+	// A nil filter contains nothing
+	return f.filters[ns].ContainsBytes(value)
+}
+
+// Filter returns the filter of the given namespace, or nil if nothing was added to the namespace. The filter is
+// not copied, so changes to it are visible in the set.
+func (f *FilterSet) Filter(ns string) *BloomFilter {
+	return f.filters[ns]
+}
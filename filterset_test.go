@@ -0,0 +1,54 @@
+package bloomflt
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestFilterSet(t *testing.T) {
+	f := NewFilterSet(100, 0.01)
+	for i := 0; i < 100; i++ {
+		f.AddNamespaced("users", []byte(fmt.Sprintf("user%d", i)))
+		f.AddNamespaced("groups", []byte(fmt.Sprintf("group%d", i)))
+	}
+
+	for i := 0; i < 100; i++ {
+		for _, tt := range []struct {
+			ns    string
+			value string
+		}{
+			{"users", fmt.Sprintf("user%d", i)},
+			{"groups", fmt.Sprintf("group%d", i)},
+		} {
+			ok := f.ContainsNamespaced(tt.ns, []byte(tt.value))
+			if !ok {
+				t.Errorf("f.ContainsNamespaced(%q, %q) = %v, want %v", tt.ns, tt.value, ok, true)
+			}
+		}
+	}
+
+	// Namespaces do not share elements
+	found := 0
+	for i := 0; i < 100; i++ {
+		if f.ContainsNamespaced("groups", []byte(fmt.Sprintf("user%d", i))) {
+			found++
+		}
+	}
+	if found > 5 {
+		t.Errorf("f.ContainsNamespaced(%q) found %d of 100 values of another namespace, want at most 5", "groups", found)
+	}
+
+	ok := f.ContainsNamespaced("unknown", []byte("user0"))
+	if ok {
+		t.Errorf("f.ContainsNamespaced(%q, %q) = %v, want %v", "unknown", "user0", ok, false)
+	}
+	if f.Filter("unknown") != nil {
+		t.Errorf("f.ContainsNamespaced() created a filter for an unused namespace")
+	}
+
+	users := f.Filter("users")
+	wantM, wantK := CalcOptimalMK(100, 0.01)
+	if users.M() != wantM || users.K() != wantK {
+		t.Errorf("f.Filter(%q) has m=%d, k=%d, want m=%d, k=%d", "users", users.M(), users.K(), wantM, wantK)
+	}
+}
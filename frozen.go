@@ -0,0 +1,41 @@
+package bloomflt
+
+// ReadOnlyFilter is an immutable view of a bloom filter, which can only be used to test for elements.
+//
+// Unlike BloomFilter, a ReadOnlyFilter is safe for concurrent use by multiple goroutines.
+type ReadOnlyFilter struct {
+	filter *BloomFilter
+}
+
+// Frozen returns a read-only view of the elements currently in the filter. The view is backed by a copy of
+// the filter, so elements added to the filter after Frozen returns are not visible in the view.
+func (b *BloomFilter) Frozen() ReadOnlyFilter {
+	return ReadOnlyFilter{b.Clone()}
+}
+
+// ContainsBytes tests if the set contains the given bytes value
+func (r ReadOnlyFilter) ContainsBytes(value []byte) bool {
+	return r.filter.ContainsBytes(value)
+}
+
+// ContainsString tests if the set contains the given string value
+func (r ReadOnlyFilter) ContainsString(value string) bool {
+	return r.filter.ContainsString(value)
+}
+
+// ContainsUInt32 tests if the set contains the given int value
+func (r ReadOnlyFilter) ContainsUInt32(value uint32) bool {
+	// The buffer of the filter can not be used, as the view can be used concurrently
+	scratch := scratchPool.Get().(*[8]byte)
+	defer scratchPool.Put(scratch)
+	r.filter.byteOrder().PutUint32(scratch[:4], value)
+	return r.filter.ContainsBytes(scratch[:4])
+}
+
+// ContainsUInt64 tests if the set contains the given int value
+func (r ReadOnlyFilter) ContainsUInt64(value uint64) bool {
+	scratch := scratchPool.Get().(*[8]byte)
+	defer scratchPool.Put(scratch)
+	r.filter.byteOrder().PutUint64(scratch[:8], value)
+	return r.filter.ContainsBytes(scratch[:8])
+}
@@ -0,0 +1,30 @@
+package bloomflt
+
+import "testing"
+
+func TestFrozen(t *testing.T) {
+	b := New(100, 0.01)
+	b.AddString("SomeValue")
+	b.AddUInt32(32)
+	b.AddUInt64(64)
+
+	r := b.Frozen()
+	if !r.ContainsString("SomeValue") {
+		t.Errorf("r.ContainsString(%q) = %v, want %v", "SomeValue", false, true)
+	}
+	if !r.ContainsBytes([]byte("SomeValue")) {
+		t.Errorf("r.ContainsBytes(%q) = %v, want %v", "SomeValue", false, true)
+	}
+	if !r.ContainsUInt32(32) {
+		t.Errorf("r.ContainsUInt32(%v) = %v, want %v", 32, false, true)
+	}
+	if !r.ContainsUInt64(64) {
+		t.Errorf("r.ContainsUInt64(%v) = %v, want %v", 64, false, true)
+	}
+
+	// Elements added after freezing are not visible in the view
+	b.AddString("AnotherValue")
+	if r.ContainsString("AnotherValue") {
+		t.Errorf("r.ContainsString(%q) = %v, want %v", "AnotherValue", true, false)
+	}
+}
@@ -0,0 +1,13 @@
+package bloomflt
+
+// Add inserts the key of v to the set, as returned by the key function. It is the same as calling b.AddBytes
+// with key(v), for values that are not bytes or strings, e.g. structs identified by one or more of their fields.
+// The same key function must be used with Contains.
+func Add[T any](b *BloomFilter, v T, key func(T) []byte) {
+	b.AddBytes(key(v))
+}
+
+// Contains tests if the set contains the key of v, as returned by the key function. See Add.
+func Contains[T any](b *BloomFilter, v T, key func(T) []byte) bool {
+	return b.ContainsBytes(key(v))
+}
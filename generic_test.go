@@ -0,0 +1,35 @@
+package bloomflt
+
+import "testing"
+
+func TestGeneric(t *testing.T) {
+	type user struct {
+		ID   string
+		Name string
+	}
+	key := func(u user) []byte {
+		return []byte(u.ID)
+	}
+
+	b := New(100, 0.01)
+	Add(b, user{"42", "Alice"}, key)
+
+	for _, tt := range []struct {
+		u    user
+		want bool
+	}{
+		{user{"42", "Alice"}, true},
+		{user{"42", "Bob"}, true},
+		{user{"43", "Alice"}, false},
+	} {
+		ok := Contains(b, tt.u, key)
+		if ok != tt.want {
+			t.Errorf("Contains(b, %v) = %v, want %v", tt.u, ok, tt.want)
+		}
+	}
+
+	ok := b.ContainsString("42")
+	if !ok {
+		t.Errorf("b.ContainsString(%q) = %v, want %v", "42", ok, true)
+	}
+}
@@ -0,0 +1,230 @@
+package bloomflt
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+)
+
+// Strategies of Guava's BloomFilter, identified by their ordinal in the serialized form.
+const (
+	guavaMurmur128Mitz32 = 0 // MURMUR128_MITZ_32
+	guavaMurmur128Mitz64 = 1 // MURMUR128_MITZ_64
+)
+
+// guavaHeaderSize is the size of the header written by BloomFilter.writeTo in Guava:
+//   - strategy ordinal (1 byte)
+//   - number of hash functions (1 byte)
+//   - number of 64-bit words of the bit array (4 bytes, big endian)
+//
+// The header is followed by the words of the bit array (8 bytes each, big endian).
+const guavaHeaderSize = 1 + 1 + 4
+
+// GuavaBloomFilter is a bloom filter that uses the bit layout and hashing of BloomFilter from Google Guava
+// (https://github.com/google/guava), so that filters created by Guava, e.g. in Java services, can be queried
+// with the same results.
+//
+// Guava hashes the bytes written by the Funnel of the filter with MurmurHash3 (x64, 128-bit). ContainsBytes
+// matches filters created with Funnels.byteArrayFunnel() and ContainsString matches filters created with
+// Funnels.stringFunnel(UTF_8). Other funnels write values in their own encoding (e.g. integerFunnel writes ints
+// as 4 bytes in little endian, and unencodedCharsFunnel writes strings as UTF-16 in little endian), which must
+// be reproduced by the caller before calling ContainsBytes.
+//
+// GuavaBloomFilter is not safe for concurrent use by multiple goroutines.
+type GuavaBloomFilter struct {
+	m        int    // Number of bits, a multiple of 64
+	k        int    // Number of hash functions
+	strategy byte   // Ordinal of the Guava strategy
+	bucket   bitset // Bit storage, in the same layout as the long array of Guava
+}
+
+// M returns the size of the bucket (number of bits) used by the filter.
+func (g *GuavaBloomFilter) M() int {
+	return g.m
+}
+
+// K returns the number of hash functions used by the filter.
+func (g *GuavaBloomFilter) K() int {
+	return g.k
+}
+
+// ImportGuava reads a filter in the serialized form written by BloomFilter.writeTo in Guava and replaces the
+// contents of g with it.
+//
+// Both strategies of Guava are supported: MURMUR128_MITZ_32 (ordinal 0), used by filters created with old
+// versions of Guava, and MURMUR128_MITZ_64 (ordinal 1), used by current versions. Filters
+// serialized with Java serialization (ObjectOutputStream) or by Apache Cassandra, which has its own format,
+// can not be read.
+func (g *GuavaBloomFilter) ImportGuava(r io.Reader) error {
+	var header [guavaHeaderSize]byte
+	_, err := io.ReadFull(r, header[:])
+	if err != nil {
+		return fmt.Errorf("bloomflt: truncated Guava header: %v", err)
+	}
+
+	strategy := header[0]
+	if strategy != guavaMurmur128Mitz32 && strategy != guavaMurmur128Mitz64 {
+		return fmt.Errorf("bloomflt: unsupported Guava strategy %d", strategy)
+	}
+	k := int(header[1])
+	words := int32(binary.BigEndian.Uint32(header[2:]))
+	if words < 1 || uint64(words) > maxBits/64 {
+		return fmt.Errorf("bloomflt: invalid number of Guava words %d", words)
+	}
+
+	// The number of words comes from untrusted data, so the bit array grows as words are read, instead of
+	// being allocated upfront, and truncated data fails before much memory is used
+	bucket := make(bitset, 0, min(int(words), readChunkSize/8))
+	chunk := make([]byte, min(int(words)*8, readChunkSize))
+	for len(bucket) < int(words) {
+		data := chunk[:min(int(words)-len(bucket), len(chunk)/8)*8]
+		_, err = io.ReadFull(r, data)
+		if err != nil {
+			return fmt.Errorf("bloomflt: truncated Guava bit array: %v", err)
+		}
+		for i := 0; i < len(data); i += 8 {
+			bucket = append(bucket, binary.BigEndian.Uint64(data[i:]))
+		}
+	}
+
+	g.m, g.k, g.strategy, g.bucket = int(words)*64, k, strategy, bucket
+	return nil
+}
+
+// AddBytes inserts a bytes value to the set, in the same way as BloomFilter.put of Guava with
+// Funnels.byteArrayFunnel().
+func (g *GuavaBloomFilter) AddBytes(value []byte) {
+	g.forEachIndex(value, func(index int) bool {
+		g.bucket.set(index)
+		return true
+	})
+}
+
+// AddString inserts a string value to the set, in the same way as BloomFilter.put of Guava with
+// Funnels.stringFunnel(UTF_8).
+func (g *GuavaBloomFilter) AddString(value string) {
+	g.AddBytes([]byte(value))
+}
+
+// ContainsBytes tests if the set contains the given bytes value, in the same way as BloomFilter.mightContain
+// of Guava with Funnels.byteArrayFunnel().
+func (g *GuavaBloomFilter) ContainsBytes(value []byte) bool {
+	ok := true
+	g.forEachIndex(value, func(index int) bool {
+		ok = g.bucket.test(index)
+		return ok
+	})
+	return ok
+}
+
+// ContainsString tests if the set contains the given string value, in the same way as
+// BloomFilter.mightContain of Guava with Funnels.stringFunnel(UTF_8).
+func (g *GuavaBloomFilter) ContainsString(value string) bool {
+	return g.ContainsBytes([]byte(value))
+}
+
+// forEachIndex calls fn with the bit index of each hash function for value, as calculated by the strategy
+// of the filter, until fn returns false.
+func (g *GuavaBloomFilter) forEachIndex(value []byte, fn func(index int) bool) {
+	h1, h2 := murmur3x64128(value, 0)
+	size := uint64(g.m)
+
+	if g.strategy == guavaMurmur128Mitz32 {
+		// Java int arithmetic on the lower 64 bits of the hash
+		hash1, hash2 := int32(h1), int32(h1>>32)
+		for i := int32(1); i <= int32(g.k); i++ {
+			combined := hash1 + i*hash2
+			if combined < 0 {
+				combined = ^combined
+			}
+			if !fn(int(uint64(combined) % size)) {
+				return
+			}
+		}
+		return
+	}
+
+	combined := h1
+	for i := 0; i < g.k; i++ {
+		if !fn(int((combined & math.MaxInt64) % size)) {
+			return
+		}
+		combined += h2
+	}
+}
+
+// murmur3x64128 returns both halves of the 128-bit MurmurHash3 (x64 variant) of data, as used by
+// Hashing.murmur3_128 in Guava. The first half holds the first 8 bytes of the hash in little endian.
+func murmur3x64128(data []byte, seed uint32) (uint64, uint64) {
+	const (
+		c1 = 0x87c37b91114253d5
+		c2 = 0x4cf5ad432745937f
+	)
+	h1, h2 := uint64(seed), uint64(seed)
+
+	n := len(data) / 16 * 16
+	for i := 0; i < n; i += 16 {
+		k1 := binary.LittleEndian.Uint64(data[i:])
+		k2 := binary.LittleEndian.Uint64(data[i+8:])
+
+		k1 *= c1
+		k1 = bits.RotateLeft64(k1, 31)
+		k1 *= c2
+		h1 ^= k1
+		h1 = bits.RotateLeft64(h1, 27)
+		h1 += h2
+		h1 = h1*5 + 0x52dce729
+
+		k2 *= c2
+		k2 = bits.RotateLeft64(k2, 33)
+		k2 *= c1
+		h2 ^= k2
+		h2 = bits.RotateLeft64(h2, 31)
+		h2 += h1
+		h2 = h2*5 + 0x38495ab5
+	}
+
+	// The remaining bytes are read as little endian, bytes 0 to 7 into k1 and bytes 8 to 14 into k2
+	tail := data[n:]
+	var k1, k2 uint64
+	for i := len(tail) - 1; i >= 0; i-- {
+		if i >= 8 {
+			k2 = k2<<8 | uint64(tail[i])
+		} else {
+			k1 = k1<<8 | uint64(tail[i])
+		}
+	}
+	if len(tail) > 8 {
+		k2 *= c2
+		k2 = bits.RotateLeft64(k2, 33)
+		k2 *= c1
+		h2 ^= k2
+	}
+	if len(tail) > 0 {
+		k1 *= c1
+		k1 = bits.RotateLeft64(k1, 31)
+		k1 *= c2
+		h1 ^= k1
+	}
+
+	h1 ^= uint64(len(data))
+	h2 ^= uint64(len(data))
+	h1 += h2
+	h2 += h1
+	h1 = fmix64(h1)
+	h2 = fmix64(h2)
+	h1 += h2
+	h2 += h1
+	return h1, h2
+}
+
+// fmix64 is the 64-bit finalizer of MurmurHash3.
+func fmix64(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	return x ^ (x >> 33)
+}
@@ -0,0 +1,142 @@
+package bloomflt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestMurmur3x64128(t *testing.T) {
+	// Test vectors from the tests of Hashing.murmur3_128 in Guava
+	for _, tt := range []struct {
+		seed   uint32
+		value  string
+		h1, h2 uint64
+	}{
+		{0, "hell", 0x629942693e10f867, 0x92db0b82baeb5347},
+		{1, "hello", 0xa78ddff5adae8d10, 0x128900ef20900135},
+		{2, "hello ", 0x8a486b23f422e826, 0xf962a2c58947765f},
+		{3, "hello w", 0x2ea59f466f6bed8c, 0xc610990acc428a17},
+		{4, "hello wo", 0x79f6305a386c572c, 0x46305aed3483b94e},
+		{5, "hello wor", 0xc2219d213ec1f1b5, 0xa1d8e2e0a52785bd},
+		{0, "The quick brown fox jumps over the lazy dog", 0xe34bbc7bbc071b6c, 0x7a433ca9c49a9347},
+		{0, "The quick brown fox jumps over the lazy cog", 0x658ca970ff85269a, 0x43fee3eaa68e5c3e},
+	} {
+		h1, h2 := murmur3x64128([]byte(tt.value), tt.seed)
+		if h1 != tt.h1 || h2 != tt.h2 {
+			t.Errorf("murmur3x64128(%q, %v) = %#x, %#x, want %#x, %#x", tt.value, tt.seed, h1, h2, tt.h1, tt.h2)
+		}
+	}
+}
+
+// guavaData returns a filter in the serialized form of Guava with the given strategy, number of hash
+// functions and words.
+func guavaData(strategy byte, k byte, words []uint64) []byte {
+	data := []byte{strategy, k}
+	data = binary.BigEndian.AppendUint32(data, uint32(len(words)))
+	for _, word := range words {
+		data = binary.BigEndian.AppendUint64(data, word)
+	}
+	return data
+}
+
+func TestImportGuava(t *testing.T) {
+	// With one hash function, MURMUR128_MITZ_64 sets bit (h1 & MaxInt64) % m, which for this value and
+	// m = 128 is bit 0x6c = 108, i.e. bit 44 of the second word
+	value := "The quick brown fox jumps over the lazy dog"
+	data := guavaData(guavaMurmur128Mitz64, 1, []uint64{0, 1 << 44})
+
+	var g GuavaBloomFilter
+	err := g.ImportGuava(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("g.ImportGuava() returned error: %v", err)
+	}
+	if g.M() != 128 || g.K() != 1 {
+		t.Errorf("g.ImportGuava() m, k = %v, %v, want %v, %v", g.M(), g.K(), 128, 1)
+	}
+	ok := g.ContainsString(value)
+	if !ok {
+		t.Errorf("g.ContainsString(%q) = %v, want %v", value, ok, true)
+	}
+	ok = g.ContainsString("The quick brown fox jumps over the lazy cog")
+	if ok {
+		t.Errorf("g.ContainsString(%q) = %v, want %v", "The quick brown fox jumps over the lazy cog", ok, false)
+	}
+}
+
+func TestGuavaStrategies(t *testing.T) {
+	for _, strategy := range []byte{guavaMurmur128Mitz32, guavaMurmur128Mitz64} {
+		var g GuavaBloomFilter
+		err := g.ImportGuava(bytes.NewReader(guavaData(strategy, 7, make([]uint64, 150))))
+		if err != nil {
+			t.Fatalf("g.ImportGuava() with strategy %d returned error: %v", strategy, err)
+		}
+
+		for i := 0; i < 1000; i++ {
+			g.AddString(fmt.Sprintf("value%d", i))
+		}
+		for i := 0; i < 1000; i++ {
+			value := fmt.Sprintf("value%d", i)
+			ok := g.ContainsString(value)
+			if !ok {
+				t.Errorf("g.ContainsString(%q) with strategy %d = %v, want %v", value, strategy, ok, true)
+			}
+		}
+
+		positives := 0
+		for i := 0; i < 10000; i++ {
+			if g.ContainsString(fmt.Sprintf("other%d", i)) {
+				positives++
+			}
+		}
+		m, k := float64(g.m), float64(g.k)
+		want := math.Pow(1-math.Exp(-k*1000/m), k)
+		got := float64(positives) / 10000
+		if math.Abs(got-want) > 0.01 {
+			t.Errorf("measured false-positive rate with strategy %d = %v, want %v", strategy, got, want)
+		}
+	}
+}
+
+func TestImportGuavaLarge(t *testing.T) {
+	// More words than fit in one chunk
+	words := make([]uint64, readChunkSize/8*2+3)
+	for i := range words {
+		words[i] = uint64(i)
+	}
+	var g GuavaBloomFilter
+	err := g.ImportGuava(bytes.NewReader(guavaData(guavaMurmur128Mitz64, 3, words)))
+	if err != nil {
+		t.Fatalf("g.ImportGuava() = %v, want nil", err)
+	}
+	if g.M() != len(words)*64 {
+		t.Errorf("g.M() = %v, want %v", g.M(), len(words)*64)
+	}
+	for i, word := range words {
+		if g.bucket[i] != word {
+			t.Fatalf("g.bucket[%d] = %v, want %v", i, g.bucket[i], word)
+		}
+	}
+}
+
+func TestImportGuavaInvalid(t *testing.T) {
+	valid := guavaData(guavaMurmur128Mitz64, 3, []uint64{1, 2})
+	huge := guavaData(guavaMurmur128Mitz64, 3, nil)
+	binary.BigEndian.PutUint32(huge[2:], math.MaxInt32)
+	for name, data := range map[string][]byte{
+		"empty":            nil,
+		"truncated header": valid[:guavaHeaderSize-1],
+		"truncated words":  valid[:len(valid)-1],
+		"unknown strategy": guavaData(2, 3, []uint64{1, 2}),
+		"no words":         guavaData(guavaMurmur128Mitz64, 3, nil),
+		"huge truncated":   huge,
+	} {
+		var g GuavaBloomFilter
+		err := g.ImportGuava(bytes.NewReader(data))
+		if err == nil {
+			t.Errorf("g.ImportGuava() of %s data = nil, want error", name)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package bloomflt
+
+// PartitionedBloomFilter is a bloom filter in which the bits are split into k partitions of equal size,
+// one for each hash function. Hash function i only sets and tests bits of partition i, so every element
+// sets exactly k bits, while the hash functions of a BloomFilter can map an element to the same bit.
+//
+// The false-positive rate after adding n elements to a filter with m bits is (1 - e^(-n/(m/k)))^k, which is
+// very close to the rate of a BloomFilter with the same m and k, but varies less between elements.
+type PartitionedBloomFilter struct {
+	m        int    // Number of bits, a multiple of k
+	k        int    // Number of hash functions and partitions
+	partSize int    // Number of bits in each partition
+	bucket   bitset // Bit storage, partition i holds bits i*partSize to (i+1)*partSize-1
+}
+
+// NewPartitionedMK creates a new partitioned bloom filter with bucket size of at least m bits and number of
+// hash functions equal to k. The value of m is rounded up to a multiple of k, so that all partitions have the
+// same size. Values of m less than 1 are replaced with 1.
+func NewPartitionedMK(m int, k int) *PartitionedBloomFilter {
+	if m < 1 {
+		m = 1
+	}
+	partSize := m
+	if k > 0 {
+		partSize = (m-1)/k + 1
+		m = partSize * k
+	}
+	return &PartitionedBloomFilter{m, k, partSize, newBitset(m)}
+}
+
+// NewPartitioned creates a new partitioned bloom filter with optimal values of m and k for the given acceptable
+// false-positive rate (value from 0.0 to 1.0).
+func NewPartitioned(n int, falsePositiveRate float64) *PartitionedBloomFilter {
+	return NewPartitionedMK(usableMK(n, falsePositiveRate))
+}
+
+// M returns the size of the bucket (number of bits) used by the filter.
+func (p *PartitionedBloomFilter) M() int {
+	return p.m
+}
+
+// K returns the number of hash functions (and partitions) used by the filter.
+func (p *PartitionedBloomFilter) K() int {
+	return p.k
+}
+
+// AddBytes inserts a bytes value to the set
+func (p *PartitionedBloomFilter) AddBytes(value []byte) {
+	h1, h2 := partitionedHashes(value)
+	for h := 0; h < p.k; h++ {
+		p.bucket.set(h*p.partSize + kiMiHash(h1, h2, h, p.partSize))
+	}
+}
+
+// AddString inserts a string value to the set
+func (p *PartitionedBloomFilter) AddString(value string) {
+	p.AddBytes([]byte(value))
+}
+
+// ContainsBytes tests if the set contains the given bytes value
+func (p *PartitionedBloomFilter) ContainsBytes(value []byte) bool {
+	h1, h2 := partitionedHashes(value)
+	for h := 0; h < p.k; h++ {
+		if !p.bucket.test(h*p.partSize + kiMiHash(h1, h2, h, p.partSize)) {
+			return false
+		}
+	}
+	return true
+}
+
+// partitionedHashes returns the base hashes of value for kiMiHash.
+//
+// Within a small partition the index of an element depends on fewer bits of the combined hash than in
+// a BloomFilter. The FNV-1a and CRC32 hashes of similar values (like "value1" and "value2") are correlated
+// enough to cause more collisions than expected, so both hashes are passed through the MurmurHash3 finalizer.
+func partitionedHashes(value []byte) (uint32, uint32) {
+	return mix32(fnvHash(value)), mix32(crcHash(value))
+}
+
+// ContainsString tests if the set contains the given string value
+func (p *PartitionedBloomFilter) ContainsString(value string) bool {
+	return p.ContainsBytes([]byte(value))
+}
+
+// Clear removes all elements from the set, while keeping the values of m and k.
+func (p *PartitionedBloomFilter) Clear() {
+	p.bucket.reset()
+}
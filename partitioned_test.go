@@ -0,0 +1,71 @@
+package bloomflt
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestNewPartitionedMK(t *testing.T) {
+	p := NewPartitionedMK(1000, 3)
+	if p.M() != 1002 || p.K() != 3 {
+		t.Errorf("NewPartitionedMK(1000, 3) m, k = %v, %v, want %v, %v", p.M(), p.K(), 1002, 3)
+	}
+
+	p.AddString("SomeValue")
+	ok := p.ContainsString("SomeValue")
+	if !ok {
+		t.Errorf("p.ContainsString(%q) = %v, want %v", "SomeValue", ok, true)
+	}
+	// Every element sets exactly one bit in each partition
+	count := p.bucket.count()
+	if count != 3 {
+		t.Errorf("p.AddString(%q) set %v bits, want %v", "SomeValue", count, 3)
+	}
+
+	p.Clear()
+	ok = p.ContainsString("SomeValue")
+	if ok {
+		t.Errorf("p.ContainsString(%q) after Clear() = %v, want %v", "SomeValue", ok, false)
+	}
+}
+
+func TestNewPartitionedMKZero(t *testing.T) {
+	p := NewPartitionedMK(0, 0)
+	p.AddString("SomeValue")
+	ok := p.ContainsString("SomeValue")
+	if !ok {
+		t.Errorf("p.ContainsString(%q) = %v, want %v", "SomeValue", ok, true)
+	}
+}
+
+func TestPartitionedFalsePositiveRateMatchesTheory(t *testing.T) {
+	for _, tt := range []struct {
+		n    int
+		rate float64
+	}{
+		{10000, 0.1},
+		{10000, 0.01},
+		{1000, 0.001},
+	} {
+		p := NewPartitioned(tt.n, tt.rate)
+		for i := 0; i < tt.n; i++ {
+			p.AddString(fmt.Sprintf("member%d", i))
+		}
+
+		trials := int(1000 / tt.rate)
+		positives := 0
+		for i := 0; i < trials; i++ {
+			if p.ContainsString(fmt.Sprintf("other%d", i)) {
+				positives++
+			}
+		}
+
+		m, k, n := float64(p.m), float64(p.k), float64(tt.n)
+		want := math.Pow(1-math.Exp(-n/(m/k)), k)
+		got := float64(positives) / float64(trials)
+		if math.Abs(got-want)/want > 0.2 {
+			t.Errorf("NewPartitioned(%v, %v) measured false-positive rate %v, want %v +/- 20%%", tt.n, tt.rate, got, want)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package bloomflt
+
+import "sync"
+
+// scratchPool holds buffers for encoding of int values in Contains methods, which can not use the buffer of
+// the wrapped filter, as they can run in parallel.
+var scratchPool = sync.Pool{
+	New: func() interface{} {
+		return new([8]byte)
+	},
+}
+
+// SafeBloomFilter is a bloom filter that is safe for concurrent use by multiple goroutines.
+//
+// Add methods are serialized, while Contains methods take a read lock and can run in parallel with
+// each other. When the filter is accessed by a single goroutine only, use the BloomFilter type instead,
+// which avoids the locking overhead.
+type SafeBloomFilter struct {
+	mu     sync.RWMutex
+	filter *BloomFilter
+}
+
+// NewSafeMK creates a new thread-safe bloom filter with bucket size equal to m and number of hash
+// functions equal to k.
+func NewSafeMK(m int, k int) *SafeBloomFilter {
+	return &SafeBloomFilter{filter: NewMK(m, k)}
+}
+
+// NewSafe creates a new thread-safe bloom filter with optimal values of m and k for the given acceptable
+// false-positive rate (value from 0.0 to 1.0).
+func NewSafe(n int, falsePositiveRate float64) *SafeBloomFilter {
+	return &SafeBloomFilter{filter: New(n, falsePositiveRate)}
+}
+
+// AddBytes inserts a bytes value to the set
+func (s *SafeBloomFilter) AddBytes(value []byte) {
+	s.mu.Lock()
+	s.filter.AddBytes(value)
+	s.mu.Unlock()
+}
+
+// AddIfNotPresent inserts a bytes value to the set and reports if it was newly added, see
+// BloomFilter.AddIfNotPresent. The test and the insert are done under a single lock, so when several
+// goroutines add the same value concurrently, only one of them gets true.
+func (s *SafeBloomFilter) AddIfNotPresent(value []byte) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.filter.AddIfNotPresent(value)
+}
+
+// OnSaturation registers fn to be called when the fill ratio of the filter exceeds the given threshold, see
+// BloomFilter.OnSaturation. The threshold is checked under the same lock as the added value, so fn is called at
+// most once, even if several goroutines add values at the same time. fn is called in a new goroutine, so that
+// it can use the filter without causing a deadlock.
+func (s *SafeBloomFilter) OnSaturation(threshold float64, fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if fn == nil {
+		s.filter.OnSaturation(threshold, nil)
+		return
+	}
+	s.filter.OnSaturation(threshold, func() { go fn() })
+}
+
+// AddString inserts a string value to the set
+func (s *SafeBloomFilter) AddString(value string) {
+	s.mu.Lock()
+	s.filter.AddString(value)
+	s.mu.Unlock()
+}
+
+// AddByteSlices inserts all given bytes values to the set. The lock is taken once for the whole batch.
+func (s *SafeBloomFilter) AddByteSlices(values ...[]byte) {
+	s.mu.Lock()
+	s.filter.AddByteSlices(values...)
+	s.mu.Unlock()
+}
+
+// AddStrings inserts all given string values to the set. The lock is taken once for the whole batch.
+func (s *SafeBloomFilter) AddStrings(values ...string) {
+	s.mu.Lock()
+	s.filter.AddStrings(values...)
+	s.mu.Unlock()
+}
+
+// AddUInt32 inserts an int value to the set
+func (s *SafeBloomFilter) AddUInt32(value uint32) {
+	s.mu.Lock()
+	s.filter.AddUInt32(value)
+	s.mu.Unlock()
+}
+
+// AddUInt64 inserts an int value to the set
+func (s *SafeBloomFilter) AddUInt64(value uint64) {
+	s.mu.Lock()
+	s.filter.AddUInt64(value)
+	s.mu.Unlock()
+}
+
+// ContainsBytes tests if the set contains the given bytes value
+func (s *SafeBloomFilter) ContainsBytes(value []byte) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.filter.ContainsBytes(value)
+}
+
+// ContainsBatch tests if the set contains each of the given bytes values and returns the results in the
+// same order as values. The read lock is taken once for the whole batch, so concurrent Add calls wait until
+// all values are tested.
+func (s *SafeBloomFilter) ContainsBatch(values [][]byte) []bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.filter.ContainsBatch(values)
+}
+
+// ContainsString tests if the set contains the given string value
+func (s *SafeBloomFilter) ContainsString(value string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.filter.ContainsString(value)
+}
+
+// ContainsUInt32 tests if the set contains the given int value
+func (s *SafeBloomFilter) ContainsUInt32(value uint32) bool {
+	scratch := scratchPool.Get().(*[8]byte)
+	defer scratchPool.Put(scratch)
+	s.filter.byteOrder().PutUint32(scratch[:4], value)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.filter.ContainsBytes(scratch[:4])
+}
+
+// ContainsUInt64 tests if the set contains the given int value
+func (s *SafeBloomFilter) ContainsUInt64(value uint64) bool {
+	scratch := scratchPool.Get().(*[8]byte)
+	defer scratchPool.Put(scratch)
+	s.filter.byteOrder().PutUint64(scratch[:8], value)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.filter.ContainsBytes(scratch[:8])
+}
+
+// Clear removes all elements from the set, while keeping the values of m and k.
+func (s *SafeBloomFilter) Clear() {
+	s.mu.Lock()
+	s.filter.Clear()
+	s.mu.Unlock()
+}
+
+// InsertCount returns the exact number of times a value was added to the set since the filter was created or
+// last cleared, see BloomFilter.InsertCount. The count is updated under the same lock as the bits, so it includes
+// all Add calls that returned before InsertCount was called.
+func (s *SafeBloomFilter) InsertCount() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.filter.InsertCount()
+}
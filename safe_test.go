@@ -0,0 +1,236 @@
+package bloomflt
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSafeConcurrent(t *testing.T) {
+	b := NewSafe(10000, 0.01)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				value := fmt.Sprintf("value%d-%d", g, i)
+				b.AddString(value)
+				if !b.ContainsString(value) {
+					t.Errorf("b.ContainsString(%q) = %v, want %v", value, false, true)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	for g := 0; g < 8; g++ {
+		for i := 0; i < 1000; i++ {
+			value := fmt.Sprintf("value%d-%d", g, i)
+			ok := b.ContainsString(value)
+			if !ok {
+				t.Errorf("b.ContainsString(%q) = %v, want %v", value, ok, true)
+			}
+		}
+	}
+}
+
+func TestSafeInsertCount(t *testing.T) {
+	s := NewSafe(1000, 0.01)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				s.AddString(fmt.Sprintf("value%d", i))
+				s.InsertCount()
+			}
+		}()
+	}
+	wg.Wait()
+
+	inserts := s.InsertCount()
+	if inserts != 800 {
+		t.Errorf("s.InsertCount() = %v, want %v", inserts, 800)
+	}
+	s.Clear()
+	inserts = s.InsertCount()
+	if inserts != 0 {
+		t.Errorf("s.InsertCount() after Clear() = %v, want %v", inserts, 0)
+	}
+}
+
+func TestSafeUInt(t *testing.T) {
+	b := NewSafeMK(1024, 3)
+	b.AddUInt32(32)
+	b.AddUInt64(64)
+	b.AddBytes([]byte("bytes"))
+
+	if !b.ContainsUInt32(32) {
+		t.Errorf("b.ContainsUInt32(%v) = %v, want %v", 32, false, true)
+	}
+	if !b.ContainsUInt64(64) {
+		t.Errorf("b.ContainsUInt64(%v) = %v, want %v", 64, false, true)
+	}
+	if !b.ContainsBytes([]byte("bytes")) {
+		t.Errorf("b.ContainsBytes(%q) = %v, want %v", "bytes", false, true)
+	}
+
+	b.Clear()
+	if b.ContainsUInt32(32) {
+		t.Errorf("b.ContainsUInt32(%v) after Clear() = %v, want %v", 32, true, false)
+	}
+}
+
+func TestSafeAddStrings(t *testing.T) {
+	b := NewSafe(100, 0.01)
+
+	b.AddStrings("value1", "value2")
+	b.AddByteSlices([]byte("value3"))
+
+	for _, value := range []string{"value1", "value2", "value3"} {
+		ok := b.ContainsString(value)
+		if !ok {
+			t.Errorf("b.ContainsString(%q) = %v, want %v", value, ok, true)
+		}
+	}
+}
+
+func TestSafeUIntConcurrent(t *testing.T) {
+	b := NewSafe(10000, 0.01)
+	for i := 0; i < 1000; i++ {
+		b.AddUInt32(uint32(i))
+		b.AddUInt64(uint64(i))
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				if !b.ContainsUInt32(uint32(i)) {
+					t.Errorf("b.ContainsUInt32(%v) = %v, want %v", i, false, true)
+				}
+				if !b.ContainsUInt64(uint64(i)) {
+					t.Errorf("b.ContainsUInt64(%v) = %v, want %v", i, false, true)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestSafeAddIfNotPresentConcurrent(t *testing.T) {
+	b := NewSafe(1000, 0.01)
+
+	var wg sync.WaitGroup
+	added := make([]int, 8)
+	for g := range added {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				if b.AddIfNotPresent([]byte(fmt.Sprintf("value%d", i))) {
+					added[g]++
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	total := 0
+	for _, n := range added {
+		total += n
+	}
+	// Each value is newly added only once, but can be reported as present due to a false positive
+	if total > 100 || total < 95 {
+		t.Errorf("b.AddIfNotPresent() returned true %v times for 100 values, want at most %v", total, 100)
+	}
+}
+
+func TestSafeOnSaturation(t *testing.T) {
+	b := NewSafe(1000, 0.01)
+	called := make(chan float64, 10)
+	b.OnSaturation(0.5, func() {
+		// The callback can use the filter
+		b.mu.RLock()
+		called <- b.filter.FillRatio()
+		b.mu.RUnlock()
+	})
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				b.AddString(fmt.Sprintf("value%d-%d", g, i))
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	fill := <-called
+	if fill <= 0.5 {
+		t.Errorf("OnSaturation(0.5) callback called at fill ratio %v, want more than %v", fill, 0.5)
+	}
+	b.AddString("SomeValue")
+	select {
+	case <-called:
+		t.Errorf("OnSaturation(0.5) callback called more than once")
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestSafeContainsBatch(t *testing.T) {
+	b := NewSafeMK(1024, 3)
+	b.AddString("SomeValue")
+
+	values := [][]byte{[]byte("SomeValue"), []byte("AnotherValue")}
+	got := b.ContainsBatch(values)
+	if len(got) != 2 || !got[0] || got[1] {
+		t.Errorf("b.ContainsBatch(%q) = %v, want %v", values, got, []bool{true, false})
+	}
+}
+
+func benchmarkSafeValues(filter *SafeBloomFilter) [][]byte {
+	values := make([][]byte, 1000)
+	for i := range values {
+		values[i] = []byte(fmt.Sprintf("value%d", i))
+		if i%2 == 0 {
+			filter.AddBytes(values[i])
+		}
+	}
+	return values
+}
+
+func BenchmarkSafeContainsBytes(b *testing.B) {
+	filter := NewSafeMK(2000000, 7)
+	values := benchmarkSafeValues(filter)
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			for _, value := range values {
+				filter.ContainsBytes(value)
+			}
+		}
+	})
+}
+
+func BenchmarkSafeContainsBatch(b *testing.B) {
+	filter := NewSafeMK(2000000, 7)
+	values := benchmarkSafeValues(filter)
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			filter.ContainsBatch(values)
+		}
+	})
+}
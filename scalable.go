@@ -0,0 +1,77 @@
+package bloomflt
+
+const (
+	// scalableGrowth is the factor by which the capacity of each new slice of ScalableBloomFilter grows.
+	scalableGrowth = 2
+	// scalableTightening is the factor by which the false-positive rate of each new slice is reduced.
+	scalableTightening = 0.8
+)
+
+// ScalableBloomFilter is a bloom filter that grows automatically, when more elements are added than it was
+// created for, as described in "Scalable Bloom Filters" by Almeida, Baquero, Preguiça and Hutchison.
+//
+// The filter is a list of BloomFilter slices. Elements are added to the newest slice only, and once it holds
+// as many elements as it was created for (at which point about half of its bits are set), a new slice with
+// twice the capacity is appended. The false-positive rate of each new slice is tighter than that of the previous
+// one, so that the false-positive rate of the whole filter stays below the rate given to NewScalable, no matter
+// how many elements are added.
+type ScalableBloomFilter struct {
+	slices   []*BloomFilter // Filters, the last one is the one elements are added to
+	capacity int            // Number of elements the last filter was created for
+	rate     float64        // False-positive rate of the last filter
+	count    int            // Number of elements added to the last filter
+}
+
+// NewScalable creates a new scalable bloom filter, which initially has room for n elements and whose
+// false-positive rate stays below the given rate (value from 0.0 to 1.0).
+func NewScalable(n int, falsePositiveRate float64) *ScalableBloomFilter {
+	if n < 1 {
+		n = 1
+	}
+	s := &ScalableBloomFilter{}
+	// The rates of all slices form a geometric series, whose sum is falsePositiveRate
+	s.addSlice(n, falsePositiveRate*(1-scalableTightening))
+	return s
+}
+
+// addSlice appends a new filter with room for n elements and the given false-positive rate.
+func (s *ScalableBloomFilter) addSlice(n int, falsePositiveRate float64) {
+	s.slices = append(s.slices, New(n, falsePositiveRate))
+	s.capacity = n
+	s.rate = falsePositiveRate
+	s.count = 0
+}
+
+// AddBytes inserts a bytes value to the set
+func (s *ScalableBloomFilter) AddBytes(value []byte) {
+	// Elements that are already present should not use up the capacity of the last slice
+	if s.ContainsBytes(value) {
+		return
+	}
+
+	s.slices[len(s.slices)-1].AddBytes(value)
+	s.count++
+	if s.count >= s.capacity {
+		s.addSlice(s.capacity*scalableGrowth, s.rate*scalableTightening)
+	}
+}
+
+// AddString inserts a string value to the set
+func (s *ScalableBloomFilter) AddString(value string) {
+	s.AddBytes([]byte(value))
+}
+
+// ContainsBytes tests if the set contains the given bytes value
+func (s *ScalableBloomFilter) ContainsBytes(value []byte) bool {
+	for _, slice := range s.slices {
+		if slice.ContainsBytes(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// ContainsString tests if the set contains the given string value
+func (s *ScalableBloomFilter) ContainsString(value string) bool {
+	return s.ContainsBytes([]byte(value))
+}
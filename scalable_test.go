@@ -0,0 +1,48 @@
+package bloomflt
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestScalable(t *testing.T) {
+	s := NewScalable(100, 0.01)
+
+	n := 10000
+	for i := 0; i < n; i++ {
+		s.AddString(fmt.Sprintf("member%d", i))
+	}
+	if len(s.slices) < 2 {
+		t.Errorf("len(s.slices) = %v after adding %v elements, want more than one", len(s.slices), n)
+	}
+
+	for i := 0; i < n; i++ {
+		value := fmt.Sprintf("member%d", i)
+		ok := s.ContainsString(value)
+		if !ok {
+			t.Errorf("s.ContainsString(%q) = %v, want %v", value, ok, true)
+		}
+	}
+
+	trials := 100000
+	positives := 0
+	for i := 0; i < trials; i++ {
+		if s.ContainsString(fmt.Sprintf("other%d", i)) {
+			positives++
+		}
+	}
+	rate := float64(positives) / float64(trials)
+	if rate > 0.01 {
+		t.Errorf("s measured false-positive rate %v, want at most %v", rate, 0.01)
+	}
+}
+
+func TestScalableDuplicates(t *testing.T) {
+	s := NewScalable(10, 0.01)
+	for i := 0; i < 100; i++ {
+		s.AddString("SomeValue")
+	}
+	if len(s.slices) != 1 {
+		t.Errorf("len(s.slices) = %v after adding the same value repeatedly, want %v", len(s.slices), 1)
+	}
+}
@@ -0,0 +1,223 @@
+package bloomflt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// ErrIncompatibleParams is returned by operations that combine the bits of two filters, when the filters were
+// created with different values of m or k, or with a different seed, domain or byte order. The bits of such
+// filters correspond to different hash positions, so they can not be combined. Use errors.Is to test for it,
+// as it is returned wrapped with the differing parameters of both filters.
+var ErrIncompatibleParams = errors.New("bloomflt: incompatible filter parameters")
+
+// Union adds all elements of other to the set by OR-ing the bits of both filters.
+// Both filters must be compatible (see Compatible), otherwise an error is returned and b is not changed.
+func (b *BloomFilter) Union(other *BloomFilter) error {
+	err := b.checkCompatible(other)
+	if err != nil {
+		return err
+	}
+	for i, word := range other.bucket {
+		b.bucket[i] |= word
+	}
+	b.stale = true
+	b.forgetInputs()
+	return nil
+}
+
+// Intersect keeps only the elements that are present in both b and other by AND-ing the bits of both filters.
+// Both filters must be compatible (see Compatible), otherwise an error is returned and b is not changed.
+//
+// The result is an approximation of the intersection of the two sets. Elements that were added to both
+// filters are guaranteed to be reported as present, but the false-positive rate of the result can be higher
+// than that of a filter to which only the common elements were added, as bits set by different elements
+// of each set can coincide.
+func (b *BloomFilter) Intersect(other *BloomFilter) error {
+	err := b.checkCompatible(other)
+	if err != nil {
+		return err
+	}
+	for i, word := range other.bucket {
+		b.bucket[i] &= word
+	}
+	b.stale = true
+	b.forgetInputs()
+	return nil
+}
+
+// Xor sets the bits of b to the bits of b XOR-ed with the bits of other. Both filters must be compatible
+// (see Compatible), otherwise an error is returned and b is not changed.
+//
+// Unlike Union and Intersect, the result is not a filter of any set: an element of the symmetric difference
+// of both sets is not guaranteed to be reported as present, as some of its bits can be set in both filters by
+// other elements. The result is mostly useful for comparing filters, e.g. its PopCount is the number of bits
+// that differ between them. Use EstimateSymmetricDifference to estimate the size of the symmetric difference.
+func (b *BloomFilter) Xor(other *BloomFilter) error {
+	err := b.checkCompatible(other)
+	if err != nil {
+		return err
+	}
+	for i, word := range other.bucket {
+		b.bucket[i] ^= word
+	}
+	b.stale = true
+	b.forgetInputs()
+	return nil
+}
+
+// IsSubsetOf returns true if every bit set in b is also set in other, i.e. if the bits of b AND-ed with the
+// bits of other are equal to the bits of b. Both filters must be compatible (see Compatible), otherwise an
+// error is returned.
+//
+// If the set of b is a subset of the set of other, the result is always true, so false means that b
+// definitely has elements that were not added to other. True means that b is probably a subset: elements of
+// b that are not in other can have all of their bits set in other by its own elements, just like false
+// positives of ContainsBytes, which gets more likely as other fills up.
+func (b *BloomFilter) IsSubsetOf(other *BloomFilter) (bool, error) {
+	err := b.checkCompatible(other)
+	if err != nil {
+		return false, err
+	}
+	for i, word := range b.bucket {
+		if word&other.bucket[i] != word {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// MergeInto adds all elements of b to other by OR-ing the bits of b into other. Both filters must be
+// compatible (see Compatible), otherwise ErrIncompatibleParams is returned and other is not changed.
+//
+// Filters with different parameters can not be merged even by rehashing, as the original elements can not
+// be recovered from the bits of a filter.
+func (b *BloomFilter) MergeInto(other *BloomFilter) error {
+	return other.Union(b)
+}
+
+// Combine returns a new filter with the elements of all given filters, by OR-ing their bits.
+// The given filters are not changed. All filters must be compatible (see Compatible), otherwise an error
+// is returned.
+func Combine(filters ...*BloomFilter) (*BloomFilter, error) {
+	if len(filters) == 0 {
+		return nil, fmt.Errorf("bloomflt: no filters to combine")
+	}
+
+	combined := filters[0].Clone()
+	for _, filter := range filters[1:] {
+		err := combined.Union(filter)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return combined, nil
+}
+
+// EstimateDifference returns an approximation of the number of distinct elements that were added to b, but
+// not to other. Both filters must be compatible (see Compatible), otherwise an error is returned.
+//
+// The number of elements in the union of both sets is estimated from the bits of b and other OR-ed together,
+// and the result is the difference between that estimate and the estimate for other (see EstimateCount).
+// Both estimates have their own error, so the result is much less accurate than EstimateCount, especially
+// when the difference is small compared to the size of the sets or when the filters are close to saturated.
+// The estimates are rounded and can not be exact, so the result is clamped at 0.
+func (b *BloomFilter) EstimateDifference(other *BloomFilter) (int, error) {
+	err := b.checkCompatible(other)
+	if err != nil {
+		return 0, err
+	}
+
+	difference := b.estimateUnion(other) - other.EstimateCount()
+	if difference < 0 {
+		return 0, nil
+	}
+	return difference, nil
+}
+
+// EstimateSymmetricDifference returns an approximation of the number of distinct elements that were added
+// to exactly one of b and other. Both filters must be compatible (see Compatible), otherwise an error is
+// returned.
+//
+// The result is calculated as twice the estimated size of the union (see EstimateDifference) minus the
+// estimated sizes of both sets, and has the same accuracy limitations as EstimateDifference.
+func (b *BloomFilter) EstimateSymmetricDifference(other *BloomFilter) (int, error) {
+	err := b.checkCompatible(other)
+	if err != nil {
+		return 0, err
+	}
+
+	difference := 2*b.estimateUnion(other) - b.EstimateCount() - other.EstimateCount()
+	if difference < 0 {
+		return 0, nil
+	}
+	return difference, nil
+}
+
+// JaccardSimilarity returns an approximation of the Jaccard index of the sets of b and other, i.e. the number
+// of elements in their intersection divided by the number of elements in their union, as a value from 0.0
+// (no common elements) to 1.0 (equal sets). Both filters must be compatible (see Compatible), otherwise an
+// error is returned. If both filters are empty, 1.0 is returned.
+//
+// The size of the union is estimated from the bits of both filters OR-ed together, and the size of the
+// intersection as the sum of the sizes of both sets minus the size of the union. This is more accurate than
+// estimating it from the bits AND-ed together, which also contain bits set by different elements of each
+// set (see Intersect). Like EstimateDifference, the result stacks several estimates, so it is only a rough
+// approximation when the sets are small, or the filters are close to saturated.
+func (b *BloomFilter) JaccardSimilarity(other *BloomFilter) (float64, error) {
+	err := b.checkCompatible(other)
+	if err != nil {
+		return 0, err
+	}
+
+	union := b.estimateUnion(other)
+	if union == 0 {
+		return 1, nil
+	}
+	intersection := b.EstimateCount() + other.EstimateCount() - union
+	similarity := float64(intersection) / float64(union)
+	return math.Max(0, math.Min(similarity, 1)), nil
+}
+
+// estimateUnion returns the approximate number of elements in the union of the sets of b and other, which
+// must have the same values of m and k.
+func (b *BloomFilter) estimateUnion(other *BloomFilter) int {
+	unionBits := 0
+	for i, word := range b.bucket {
+		unionBits += bits.OnesCount64(word | other.bucket[i])
+	}
+	return estimateCount(b.m, b.k, unionBits)
+}
+
+// Compatible returns true if the bits of b and other can be combined by Union, Intersect and the other
+// operations on two filters, which is the case when both filters have the same values of m and k, and use
+// the same seed (see NewSeeded), domain (see NewWithDomain) and byte order (see NewWithByteOrder).
+//
+// Filters created with different hash functions (see NewWithHashes) are also reported as compatible, as functions
+// can not be compared. Combining them does not return an error, but elements of either filter are then found
+// only by chance, as each filter sets different bits for the same values.
+func (b *BloomFilter) Compatible(other *BloomFilter) bool {
+	return b.m == other.m && b.k == other.k && b.seed == other.seed && bytes.Equal(b.domain, other.domain) &&
+		b.byteOrder() == other.byteOrder()
+}
+
+// checkCompatible returns an error if the bits of b and other can not be combined, because the filters
+// were created with different values of m or k, or with a different seed, domain or byte order.
+func (b *BloomFilter) checkCompatible(other *BloomFilter) error {
+	if b.m != other.m || b.k != other.k {
+		return fmt.Errorf("%w: m=%d, k=%d and m=%d, k=%d", ErrIncompatibleParams, b.m, b.k, other.m, other.k)
+	}
+	if b.seed != other.seed {
+		return fmt.Errorf("%w: seed=%d and seed=%d", ErrIncompatibleParams, b.seed, other.seed)
+	}
+	if !bytes.Equal(b.domain, other.domain) {
+		return fmt.Errorf("%w: domain=%q and domain=%q", ErrIncompatibleParams, b.domainName(), other.domainName())
+	}
+	if b.byteOrder() != other.byteOrder() {
+		return fmt.Errorf("%w: byte order %v and %v", ErrIncompatibleParams, b.byteOrder(), other.byteOrder())
+	}
+	return nil
+}
@@ -0,0 +1,364 @@
+package bloomflt
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestUnion(t *testing.T) {
+	b1 := New(200, 0.01)
+	b2 := New(200, 0.01)
+	for i := 0; i < 100; i++ {
+		b1.AddString(fmt.Sprintf("first%d", i))
+		b2.AddString(fmt.Sprintf("second%d", i))
+	}
+
+	err := b1.Union(b2)
+	if err != nil {
+		t.Fatalf("b1.Union(b2) returned error: %v", err)
+	}
+
+	for i := 0; i < 100; i++ {
+		for _, value := range []string{fmt.Sprintf("first%d", i), fmt.Sprintf("second%d", i)} {
+			ok := b1.ContainsString(value)
+			if !ok {
+				t.Errorf("b1.ContainsString(%q) = %v, want %v", value, ok, true)
+			}
+		}
+	}
+}
+
+func TestUnionIncompatible(t *testing.T) {
+	b := NewMK(64, 2)
+	for _, other := range []*BloomFilter{NewMK(128, 2), NewMK(64, 3)} {
+		err := b.Union(other)
+		if err == nil {
+			t.Errorf("b.Union(m=%d, k=%d) = nil, want error", other.m, other.k)
+		}
+	}
+}
+
+func TestCompatible(t *testing.T) {
+	b := NewMK(64, 2)
+	for _, tt := range []struct {
+		other *BloomFilter
+		want  bool
+	}{
+		{NewMK(64, 2), true},
+		{NewSeeded(64, 2, 0), true},
+		{NewWithByteOrder(64, 2, binary.LittleEndian), true},
+		{NewMK(128, 2), false},
+		{NewMK(64, 3), false},
+		{NewSeeded(64, 2, 42), false},
+		{NewWithDomain(64, 2, []byte("tenant")), false},
+		{NewWithByteOrder(64, 2, binary.BigEndian), false},
+	} {
+		ok := b.Compatible(tt.other)
+		if ok != tt.want {
+			t.Errorf("b.Compatible(m=%d, k=%d) = %v, want %v", tt.other.m, tt.other.k, ok, tt.want)
+		}
+	}
+}
+
+func TestUnionDifferentHashing(t *testing.T) {
+	for _, tt := range []struct {
+		b, other *BloomFilter
+		want     string
+	}{
+		{NewSeeded(64, 2, 1), NewSeeded(64, 2, 2), "seed=1 and seed=2"},
+		{NewWithDomain(64, 2, []byte("a")), NewWithDomain(64, 2, []byte("b")), `domain="a" and domain="b"`},
+		{NewMK(64, 2), NewWithByteOrder(64, 2, binary.BigEndian), "byte order LittleEndian and BigEndian"},
+	} {
+		tt.other.AddString("SomeValue")
+		err := tt.b.Union(tt.other)
+		if !errors.Is(err, ErrIncompatibleParams) || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("b.Union(%s) = %v, want %v", tt.want, err, ErrIncompatibleParams)
+		}
+		if count := tt.b.PopCount(); count != 0 {
+			t.Errorf("b.PopCount() after failed Union(%s) = %v, want %v", tt.want, count, 0)
+		}
+	}
+}
+
+func TestIsSubsetOf(t *testing.T) {
+	parent := New(200, 0.01)
+	child := New(200, 0.01)
+	for i := 0; i < 100; i++ {
+		parent.AddString(fmt.Sprintf("value%d", i))
+	}
+	for i := 0; i < 10; i++ {
+		child.AddString(fmt.Sprintf("value%d", i))
+	}
+
+	for _, tt := range []struct {
+		name     string
+		b, other *BloomFilter
+		want     bool
+	}{
+		{"child.IsSubsetOf(parent)", child, parent, true},
+		{"parent.IsSubsetOf(child)", parent, child, false},
+		{"parent.IsSubsetOf(parent)", parent, parent, true},
+		{"empty.IsSubsetOf(child)", New(200, 0.01), child, true},
+	} {
+		ok, err := tt.b.IsSubsetOf(tt.other)
+		if err != nil {
+			t.Fatalf("%s returned error: %v", tt.name, err)
+		}
+		if ok != tt.want {
+			t.Errorf("%s = %v, want %v", tt.name, ok, tt.want)
+		}
+	}
+
+	child.AddString("SomeValue")
+	ok, _ := child.IsSubsetOf(parent)
+	if ok {
+		t.Errorf("child.IsSubsetOf(parent) after adding another value = %v, want %v", ok, false)
+	}
+
+	_, err := child.IsSubsetOf(NewMK(64, 2))
+	if !errors.Is(err, ErrIncompatibleParams) {
+		t.Errorf("child.IsSubsetOf(m=64, k=2) = %v, want %v", err, ErrIncompatibleParams)
+	}
+}
+
+func TestMergeInto(t *testing.T) {
+	b := New(100, 0.01)
+	other := New(100, 0.01)
+	b.AddString("SomeValue")
+	other.AddString("AnotherValue")
+
+	err := b.MergeInto(other)
+	if err != nil {
+		t.Fatalf("b.MergeInto(other) returned error: %v", err)
+	}
+	for _, value := range []string{"SomeValue", "AnotherValue"} {
+		ok := other.ContainsString(value)
+		if !ok {
+			t.Errorf("other.ContainsString(%q) = %v, want %v", value, ok, true)
+		}
+	}
+	ok := b.ContainsString("AnotherValue")
+	if ok {
+		t.Errorf("b.ContainsString(%q) = %v, want %v", "AnotherValue", ok, false)
+	}
+}
+
+func TestMergeIntoIncompatible(t *testing.T) {
+	b := NewMK(64, 2)
+	for _, other := range []*BloomFilter{NewMK(128, 2), NewMK(64, 3)} {
+		err := b.MergeInto(other)
+		if !errors.Is(err, ErrIncompatibleParams) {
+			t.Errorf("b.MergeInto(m=%d, k=%d) = %v, want %v", other.m, other.k, err, ErrIncompatibleParams)
+		}
+	}
+}
+
+func TestIntersect(t *testing.T) {
+	b1 := New(200, 0.01)
+	b2 := New(200, 0.01)
+	for i := 0; i < 100; i++ {
+		b1.AddString(fmt.Sprintf("common%d", i))
+		b2.AddString(fmt.Sprintf("common%d", i))
+		b1.AddString(fmt.Sprintf("first%d", i))
+		b2.AddString(fmt.Sprintf("second%d", i))
+	}
+
+	err := b1.Intersect(b2)
+	if err != nil {
+		t.Fatalf("b1.Intersect(b2) returned error: %v", err)
+	}
+
+	for i := 0; i < 100; i++ {
+		value := fmt.Sprintf("common%d", i)
+		ok := b1.ContainsString(value)
+		if !ok {
+			t.Errorf("b1.ContainsString(%q) = %v, want %v", value, ok, true)
+		}
+	}
+}
+
+func TestIntersectIncompatible(t *testing.T) {
+	b := NewMK(64, 2)
+	for _, other := range []*BloomFilter{NewMK(128, 2), NewMK(64, 3)} {
+		err := b.Intersect(other)
+		if err == nil {
+			t.Errorf("b.Intersect(m=%d, k=%d) = nil, want error", other.m, other.k)
+		}
+	}
+}
+
+func TestXor(t *testing.T) {
+	b1 := NewMK(128, 1)
+	b2 := NewMK(128, 1)
+	b1.SetBit(1)
+	b1.SetBit(100)
+	b2.SetBit(100)
+	b2.SetBit(127)
+
+	err := b1.Xor(b2)
+	if err != nil {
+		t.Fatalf("b1.Xor(b2) returned error: %v", err)
+	}
+	for _, tt := range []struct {
+		index int
+		want  bool
+	}{
+		{1, true},
+		{100, false},
+		{127, true},
+	} {
+		ok := b1.TestBit(tt.index)
+		if ok != tt.want {
+			t.Errorf("b1.TestBit(%v) after Xor() = %v, want %v", tt.index, ok, tt.want)
+		}
+	}
+
+	err = b1.Xor(NewMK(64, 1))
+	if !errors.Is(err, ErrIncompatibleParams) {
+		t.Errorf("b1.Xor(m=64, k=1) = %v, want %v", err, ErrIncompatibleParams)
+	}
+}
+
+func TestCombine(t *testing.T) {
+	shards := []*BloomFilter{New(300, 0.01), New(300, 0.01), New(300, 0.01)}
+	for i := 0; i < 300; i++ {
+		shards[i%3].AddString(fmt.Sprintf("value%d", i))
+	}
+	snapshots := []*BloomFilter{shards[0].Clone(), shards[1].Clone(), shards[2].Clone()}
+
+	combined, err := Combine(shards...)
+	if err != nil {
+		t.Fatalf("Combine() returned error: %v", err)
+	}
+
+	for i := 0; i < 300; i++ {
+		value := fmt.Sprintf("value%d", i)
+		ok := combined.ContainsString(value)
+		if !ok {
+			t.Errorf("combined.ContainsString(%q) = %v, want %v", value, ok, true)
+		}
+	}
+	for i, shard := range shards {
+		if !shard.Equal(snapshots[i]) {
+			t.Errorf("Combine() changed shard %d", i)
+		}
+	}
+}
+
+func TestCombineInvalid(t *testing.T) {
+	_, err := Combine()
+	if err == nil {
+		t.Errorf("Combine() = nil, want error")
+	}
+
+	_, err = Combine(NewMK(64, 2), NewMK(64, 2), NewMK(64, 3))
+	if err == nil {
+		t.Errorf("Combine() of incompatible filters = nil, want error")
+	}
+}
+
+func TestEstimateDifference(t *testing.T) {
+	b1 := New(2000, 0.01)
+	b2 := New(2000, 0.01)
+	for i := 0; i < 1000; i++ {
+		b1.AddString(fmt.Sprintf("value%d", i))
+		b2.AddString(fmt.Sprintf("value%d", i+600))
+	}
+
+	difference, err := b1.EstimateDifference(b2)
+	if err != nil {
+		t.Fatalf("b1.EstimateDifference(b2) returned error: %v", err)
+	}
+	if difference < 500 || difference > 700 {
+		t.Errorf("b1.EstimateDifference(b2) = %v, want approximately %v", difference, 600)
+	}
+
+	difference, err = b1.EstimateDifference(b1)
+	if err != nil {
+		t.Fatalf("b1.EstimateDifference(b1) returned error: %v", err)
+	}
+	if difference != 0 {
+		t.Errorf("b1.EstimateDifference(b1) = %v, want %v", difference, 0)
+	}
+
+	_, err = b1.EstimateDifference(NewMK(64, 2))
+	if !errors.Is(err, ErrIncompatibleParams) {
+		t.Errorf("b1.EstimateDifference(m=64, k=2) = %v, want %v", err, ErrIncompatibleParams)
+	}
+}
+
+func TestJaccardSimilarity(t *testing.T) {
+	b1 := New(2000, 0.01)
+	b2 := New(2000, 0.01)
+	for i := 0; i < 1000; i++ {
+		b1.AddString(fmt.Sprintf("value%d", i))
+		b2.AddString(fmt.Sprintf("value%d", i+500))
+	}
+
+	// 500 common elements out of 1500
+	similarity, err := b1.JaccardSimilarity(b2)
+	if err != nil {
+		t.Fatalf("b1.JaccardSimilarity(b2) returned error: %v", err)
+	}
+	if math.Abs(similarity-1.0/3) > 0.05 {
+		t.Errorf("b1.JaccardSimilarity(b2) = %v, want approximately %v", similarity, 1.0/3)
+	}
+
+	for _, tt := range []struct {
+		name string
+		b1   *BloomFilter
+		b2   *BloomFilter
+		want float64
+	}{
+		{"b1, b1", b1, b1, 1},
+		{"empty, empty", New(2000, 0.01), New(2000, 0.01), 1},
+		{"b1, empty", b1, New(2000, 0.01), 0},
+	} {
+		similarity, err = tt.b1.JaccardSimilarity(tt.b2)
+		if err != nil {
+			t.Fatalf("JaccardSimilarity(%s) returned error: %v", tt.name, err)
+		}
+		if similarity != tt.want {
+			t.Errorf("JaccardSimilarity(%s) = %v, want %v", tt.name, similarity, tt.want)
+		}
+	}
+
+	_, err = b1.JaccardSimilarity(NewMK(64, 2))
+	if !errors.Is(err, ErrIncompatibleParams) {
+		t.Errorf("b1.JaccardSimilarity(m=64, k=2) = %v, want %v", err, ErrIncompatibleParams)
+	}
+}
+
+func TestEstimateSymmetricDifference(t *testing.T) {
+	b1 := New(2000, 0.01)
+	b2 := New(2000, 0.01)
+	for i := 0; i < 1000; i++ {
+		b1.AddString(fmt.Sprintf("value%d", i))
+		b2.AddString(fmt.Sprintf("value%d", i+600))
+	}
+
+	difference, err := b1.EstimateSymmetricDifference(b2)
+	if err != nil {
+		t.Fatalf("b1.EstimateSymmetricDifference(b2) returned error: %v", err)
+	}
+	if difference < 1100 || difference > 1300 {
+		t.Errorf("b1.EstimateSymmetricDifference(b2) = %v, want approximately %v", difference, 1200)
+	}
+
+	difference, err = b1.EstimateSymmetricDifference(b1)
+	if err != nil {
+		t.Fatalf("b1.EstimateSymmetricDifference(b1) returned error: %v", err)
+	}
+	if difference != 0 {
+		t.Errorf("b1.EstimateSymmetricDifference(b1) = %v, want %v", difference, 0)
+	}
+
+	_, err = b1.EstimateSymmetricDifference(NewMK(64, 2))
+	if !errors.Is(err, ErrIncompatibleParams) {
+		t.Errorf("b1.EstimateSymmetricDifference(m=64, k=2) = %v, want %v", err, ErrIncompatibleParams)
+	}
+}
@@ -0,0 +1,113 @@
+package bloomflt
+
+import (
+	"encoding/binary"
+	"sync"
+)
+
+// ShardedBloomFilter is a bloom filter that is safe for concurrent use by multiple goroutines and is split into
+// independent shards, each guarded by its own lock, so that goroutines adding elements to different shards do
+// not block each other.
+//
+// Every element is stored in a single shard, selected by its first base hash, and only that shard is locked when
+// the element is added or tested.
+//
+// The bits are divided equally between the shards, so the filter uses about the same memory as a BloomFilter with
+// the same m. However elements are not spread perfectly evenly between the shards, so the fuller shards have a
+// somewhat higher false-positive rate than a single filter with m bits would have. The difference grows with the
+// number of shards and shrinks with the number of elements.
+type ShardedBloomFilter struct {
+	shards []shard
+}
+
+// shard is one of the independent parts of a ShardedBloomFilter.
+type shard struct {
+	mu     sync.RWMutex
+	filter *BloomFilter
+}
+
+// NewShardedMK creates a new sharded bloom filter with total bucket size equal to m, split equally between the
+// given number of shards, and number of hash functions equal to k.
+func NewShardedMK(m int, k int, shards int) *ShardedBloomFilter {
+	if shards < 1 {
+		shards = 1
+	}
+	s := &ShardedBloomFilter{shards: make([]shard, shards)}
+	for i := range s.shards {
+		s.shards[i].filter = NewMK((m+shards-1)/shards, k)
+	}
+	return s
+}
+
+// NewSharded creates a new sharded bloom filter with optimal values of m and k for the given acceptable
+// false-positive rate (value from 0.0 to 1.0), split into the given number of shards.
+func NewSharded(n int, falsePositiveRate float64, shards int) *ShardedBloomFilter {
+	m, k := usableMK(n, falsePositiveRate)
+	return NewShardedMK(m, k, shards)
+}
+
+// shardFor returns the shard for the given value and the base hashes of the value.
+func (s *ShardedBloomFilter) shardFor(value []byte) (*shard, uint32, uint32) {
+	filter := s.shards[0].filter
+	h1, h2 := filter.hash1(value), filter.hash2(value)
+	// kiMiHash uses the high bits of the hashes, so select the shard by the low bits
+	return &s.shards[h1%uint32(len(s.shards))], h1, h2
+}
+
+// AddBytes inserts a bytes value to the set
+func (s *ShardedBloomFilter) AddBytes(value []byte) {
+	shard, h1, h2 := s.shardFor(value)
+	shard.mu.Lock()
+	shard.filter.AddHashed(h1, h2)
+	shard.mu.Unlock()
+}
+
+// AddString inserts a string value to the set
+func (s *ShardedBloomFilter) AddString(value string) {
+	s.AddBytes([]byte(value))
+}
+
+// AddUInt32 inserts an int value to the set
+func (s *ShardedBloomFilter) AddUInt32(value uint32) {
+	scratch := scratchPool.Get().(*[8]byte)
+	binary.LittleEndian.PutUint32(scratch[:4], value)
+	s.AddBytes(scratch[:4])
+	scratchPool.Put(scratch)
+}
+
+// AddUInt64 inserts an int value to the set
+func (s *ShardedBloomFilter) AddUInt64(value uint64) {
+	scratch := scratchPool.Get().(*[8]byte)
+	binary.LittleEndian.PutUint64(scratch[:8], value)
+	s.AddBytes(scratch[:8])
+	scratchPool.Put(scratch)
+}
+
+// ContainsBytes tests if the set contains the given bytes value
+func (s *ShardedBloomFilter) ContainsBytes(value []byte) bool {
+	shard, h1, h2 := s.shardFor(value)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+	return shard.filter.ContainsHashed(h1, h2)
+}
+
+// ContainsString tests if the set contains the given string value
+func (s *ShardedBloomFilter) ContainsString(value string) bool {
+	return s.ContainsBytes([]byte(value))
+}
+
+// ContainsUInt32 tests if the set contains the given int value
+func (s *ShardedBloomFilter) ContainsUInt32(value uint32) bool {
+	scratch := scratchPool.Get().(*[8]byte)
+	defer scratchPool.Put(scratch)
+	binary.LittleEndian.PutUint32(scratch[:4], value)
+	return s.ContainsBytes(scratch[:4])
+}
+
+// ContainsUInt64 tests if the set contains the given int value
+func (s *ShardedBloomFilter) ContainsUInt64(value uint64) bool {
+	scratch := scratchPool.Get().(*[8]byte)
+	defer scratchPool.Put(scratch)
+	binary.LittleEndian.PutUint64(scratch[:8], value)
+	return s.ContainsBytes(scratch[:8])
+}
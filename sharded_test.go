@@ -0,0 +1,65 @@
+package bloomflt
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestShardedConcurrent(t *testing.T) {
+	s := NewSharded(8000, 0.01, 8)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				s.AddString(fmt.Sprintf("value%d-%d", g, i))
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	for g := 0; g < 8; g++ {
+		for i := 0; i < 1000; i++ {
+			value := fmt.Sprintf("value%d-%d", g, i)
+			ok := s.ContainsString(value)
+			if !ok {
+				t.Errorf("s.ContainsString(%q) = %v, want %v", value, ok, true)
+			}
+		}
+	}
+
+	// Every shard should get a part of the elements
+	for i := range s.shards {
+		if s.shards[i].filter.PopCount() == 0 {
+			t.Errorf("shard %d has no elements", i)
+		}
+	}
+
+	trials := 100000
+	positives := 0
+	for i := 0; i < trials; i++ {
+		if s.ContainsString(fmt.Sprintf("other%d", i)) {
+			positives++
+		}
+	}
+	rate := float64(positives) / float64(trials)
+	if rate > 0.015 {
+		t.Errorf("s measured false-positive rate %v, want at most %v", rate, 0.015)
+	}
+}
+
+func TestShardedUInt(t *testing.T) {
+	s := NewShardedMK(4096, 3, 4)
+	s.AddUInt32(32)
+	s.AddUInt64(64)
+
+	if !s.ContainsUInt32(32) {
+		t.Errorf("s.ContainsUInt32(%v) = %v, want %v", 32, false, true)
+	}
+	if !s.ContainsUInt64(64) {
+		t.Errorf("s.ContainsUInt64(%v) = %v, want %v", 64, false, true)
+	}
+}
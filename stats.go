@@ -0,0 +1,229 @@
+package bloomflt
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"unsafe"
+)
+
+// Stats is a snapshot of metrics describing the state of a filter.
+type Stats struct {
+	M                          int     // Number of bits
+	K                          int     // Number of hash functions
+	SetBits                    int     // Number of bits that are set, see PopCount
+	FillRatio                  float64 // Fraction of bits that are set, see FillRatio
+	EstimatedCount             int     // Approximate number of elements, see EstimateCount
+	EstimatedFalsePositiveRate float64 // Current false-positive rate, see FalsePositiveRate
+}
+
+// Stats returns the metrics of the filter. All metrics are computed from a single count of the set bits,
+// so they are consistent with each other and cheaper to get than by calling each method separately.
+func (b *BloomFilter) Stats() Stats {
+	setBits := b.PopCount()
+	return Stats{
+		M:                          b.m,
+		K:                          b.k,
+		SetBits:                    setBits,
+		FillRatio:                  fillRatio(b.m, setBits),
+		EstimatedCount:             estimateCount(b.m, b.k, setBits),
+		EstimatedFalsePositiveRate: falsePositiveRate(b.m, b.k, setBits),
+	}
+}
+
+// FillRatio returns the fraction of bits in the filter that are set, as a value from 0.0 to 1.0.
+//
+// The false-positive rate of the filter grows with the fill ratio, so a value approaching 1.0 means
+// that the filter is saturated and should be replaced with a larger one.
+func (b *BloomFilter) FillRatio() float64 {
+	return fillRatio(b.m, b.PopCount())
+}
+
+// fillRatio returns the fraction of set bits in a filter with m bits, of which setBits are set.
+func fillRatio(m int, setBits int) float64 {
+	if m == 0 {
+		return 0
+	}
+	return float64(setBits) / float64(m)
+}
+
+// EstimateCount returns an approximation of the number of distinct elements added to the filter,
+// calculated from the number of set bits (X) as -(m/k) * ln(1 - X/m).
+//
+// When all bits are set the formula diverges, so the estimate for m-1 set bits is returned instead,
+// which should be treated as a lower bound.
+func (b *BloomFilter) EstimateCount() int {
+	return estimateCount(b.m, b.k, b.PopCount())
+}
+
+// estimateCount returns the approximate number of elements in a filter with m bits and k hash
+// functions, of which setBits are set.
+func estimateCount(m int, k int, setBits int) int {
+	if m == 0 || k == 0 {
+		return 0
+	}
+	if setBits >= m {
+		setBits = m - 1
+	}
+	n := -float64(m) / float64(k) * math.Log(1-float64(setBits)/float64(m))
+	return int(n + 0.5)
+}
+
+// FalsePositiveRate returns the probability that testing an element, which was not added to the set,
+// returns true given the current state of the filter. It is calculated from the number of set bits (X)
+// as (X/m)^k.
+//
+// Unlike the rate given to New, which assumes that exactly n elements are added, this rate reflects the
+// actual number of elements in the filter.
+func (b *BloomFilter) FalsePositiveRate() float64 {
+	return falsePositiveRate(b.m, b.k, b.PopCount())
+}
+
+// RemainingCapacity returns the approximate number of distinct elements that can still be added to the filter,
+// before its false-positive rate (see FalsePositiveRate) exceeds targetRate.
+//
+// The rate exceeds targetRate once the fill ratio exceeds targetRate^(1/k), and n elements are expected to
+// fill a fraction of 1 - e^(-k*n/m) bits, so the remaining capacity is the difference between the number of
+// elements for that fill ratio and the number of elements for the current fill ratio. If the rate already
+// exceeds targetRate, 0 is returned.
+func (b *BloomFilter) RemainingCapacity(targetRate float64) int {
+	if b.k == 0 || targetRate >= 1 {
+		return maxBits
+	}
+	if targetRate <= 0 {
+		return 0
+	}
+
+	maxFill := math.Pow(targetRate, 1/float64(b.k))
+	fill := b.FillRatio()
+	if fill >= maxFill {
+		return 0
+	}
+	remaining := -float64(b.m) / float64(b.k) * (math.Log(1-maxFill) - math.Log(1-fill))
+	if remaining >= maxBits {
+		return maxBits
+	}
+	return int(remaining)
+}
+
+// Recommend returns the optimal values of m and k for a new filter with the given acceptable false-positive
+// rate, holding as many elements as are estimated to be in this filter (see EstimateCount). It can be used to
+// size a filter better after the actual number of elements becomes known. At least one element is assumed,
+// and the values are limited in the same way as in New.
+func (b *BloomFilter) Recommend(targetRate float64) (m int, k int) {
+	n := b.EstimateCount()
+	if n < 1 {
+		n = 1
+	}
+	return usableMK(n, targetRate)
+}
+
+// falsePositiveRate returns the false-positive rate of a filter with m bits and k hash functions, of which
+// setBits are set.
+func falsePositiveRate(m int, k int, setBits int) float64 {
+	if m == 0 {
+		return 1
+	}
+	return math.Pow(float64(setBits)/float64(m), float64(k))
+}
+
+// PopCount returns the number of bits in the filter that are set.
+func (b *BloomFilter) PopCount() int {
+	return b.bucket.count()
+}
+
+const (
+	// dumpColumns is the number of bits written by DumpBits on each row.
+	dumpColumns = 64
+	// maxDumpBits is the largest number of bits that DumpBits writes, i.e. 1024 rows.
+	maxDumpBits = 1024 * dumpColumns
+)
+
+// DumpBits writes the bits of the filter to w as text, for inspection of small filters, e.g. while debugging
+// or teaching. Each bit is written as '0' or '1', starting with bit 0, in rows of 64 bits ending with a newline.
+// The last row is shorter if m is not a multiple of 64.
+//
+// The text takes a byte per bit, so only filters of up to 65536 bits (1024 rows) can be dumped and an error is
+// returned for larger ones, without writing anything. Errors returned by w are passed to the caller.
+func (b *BloomFilter) DumpBits(w io.Writer) error {
+	if b.m > maxDumpBits {
+		return fmt.Errorf("bloomflt: can not dump %d bits, the maximum is %d", b.m, maxDumpBits)
+	}
+
+	row := make([]byte, 0, dumpColumns+1)
+	for start := 0; start < b.m; start += dumpColumns {
+		row = row[:0]
+		for i := start; i < start+dumpColumns && i < b.m; i++ {
+			if b.bucket.test(i) {
+				row = append(row, '1')
+			} else {
+				row = append(row, '0')
+			}
+		}
+		row = append(row, '\n')
+		_, err := w.Write(row)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MeasureFalsePositiveRate returns the fraction of the given number of random values that are reported as
+// present by b. The values are 16 random bytes generated by rng, so it is very unlikely that any of them was
+// added to the filter and the result is an empirical false-positive rate.
+//
+// It can be compared with FalsePositiveRate to detect problems that the formula can not account for, like
+// poorly distributed hash functions. The result has a standard error of about sqrt(rate/trials), so many
+// more trials than 1/rate are needed for low rates.
+func MeasureFalsePositiveRate(b *BloomFilter, trials int, rng *rand.Rand) float64 {
+	if trials < 1 {
+		return 0
+	}
+
+	var value [16]byte
+	positives := 0
+	for i := 0; i < trials; i++ {
+		binary.LittleEndian.PutUint64(value[:8], rng.Uint64())
+		binary.LittleEndian.PutUint64(value[8:], rng.Uint64())
+		if b.ContainsBytes(value[:]) {
+			positives++
+		}
+	}
+	return float64(positives) / float64(trials)
+}
+
+// IsEmpty returns true if no bits of the filter are set, i.e. if nothing was added to the set since it was
+// created or cleared. Contains methods return false for all values of an empty filter.
+func (b *BloomFilter) IsEmpty() bool {
+	for _, word := range b.bucket {
+		if word != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// IsSaturated returns true if all bits of the filter are set. Contains methods return true for all values of
+// a saturated filter, so it is of no use anymore and should be replaced with a larger one.
+func (b *BloomFilter) IsSaturated() bool {
+	return b.PopCount() == b.m
+}
+
+// EstimateMemoryBytes returns the number of bytes that a BloomFilter with m bits occupies in memory: the bit
+// storage, which is ceil(m/8) bytes rounded up to whole 64-bit words, plus the size of the BloomFilter struct.
+// Memory used by the hash functions given to NewWithHashes is not included.
+func EstimateMemoryBytes(m int) int {
+	if m < 1 {
+		m = 1
+	}
+	return int(unsafe.Sizeof(BloomFilter{})) + ((m-1)/64+1)*8
+}
+
+// MemoryBytes returns the number of bytes that the filter occupies in memory, calculated in the same way as
+// EstimateMemoryBytes, but from the words actually allocated for the bit storage.
+func (b *BloomFilter) MemoryBytes() int {
+	return int(unsafe.Sizeof(*b)) + cap(b.bucket)*8
+}
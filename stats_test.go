@@ -0,0 +1,282 @@
+package bloomflt
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+	"unsafe"
+)
+
+func TestPopCount(t *testing.T) {
+	b := NewMK(1024, 3)
+	count := b.PopCount()
+	if count != 0 {
+		t.Errorf("b.PopCount() = %v, want %v", count, 0)
+	}
+
+	b.AddString("SomeValue")
+	count = b.PopCount()
+	if count < 1 || count > 3 {
+		t.Errorf("b.PopCount() = %v, want value from 1 to 3", count)
+	}
+
+	for i := 0; i < 10000; i++ {
+		b.AddString(fmt.Sprintf("value%d", i))
+	}
+	count = b.PopCount()
+	if count != 1024 {
+		t.Errorf("b.PopCount() = %v, want %v", count, 1024)
+	}
+}
+
+func TestFillRatio(t *testing.T) {
+	b := NewMK(1000, 3)
+	ratio := b.FillRatio()
+	if ratio != 0 {
+		t.Errorf("b.FillRatio() = %v, want %v", ratio, 0)
+	}
+
+	for i := 0; i < 10000; i++ {
+		b.AddString(fmt.Sprintf("value%d", i))
+		ratio = b.FillRatio()
+		if ratio < 0 || ratio > 1 {
+			t.Fatalf("b.FillRatio() = %v, want value from 0.0 to 1.0", ratio)
+		}
+	}
+	if ratio != 1 {
+		t.Errorf("b.FillRatio() = %v, want %v", ratio, 1)
+	}
+}
+
+func TestEstimateCount(t *testing.T) {
+	b := New(10000, 0.01)
+	count := b.EstimateCount()
+	if count != 0 {
+		t.Errorf("b.EstimateCount() = %v, want %v", count, 0)
+	}
+
+	for i := 0; i < 5000; i++ {
+		b.AddString(fmt.Sprintf("value%d", i))
+	}
+	count = b.EstimateCount()
+	if count < 4900 || count > 5100 {
+		t.Errorf("b.EstimateCount() = %v, want approximately %v", count, 5000)
+	}
+}
+
+func TestEstimateCountSaturated(t *testing.T) {
+	b := NewMK(64, 2)
+	for i := 0; i < 10000; i++ {
+		b.AddString(fmt.Sprintf("value%d", i))
+	}
+
+	count := b.EstimateCount()
+	if count <= 0 {
+		t.Errorf("b.EstimateCount() of saturated filter = %v, want positive value", count)
+	}
+}
+
+func TestFalsePositiveRate(t *testing.T) {
+	b := New(1000, 0.01)
+	rate := b.FalsePositiveRate()
+	if rate != 0 {
+		t.Errorf("b.FalsePositiveRate() = %v, want %v", rate, 0)
+	}
+
+	for i := 0; i < 1000; i++ {
+		b.AddString(fmt.Sprintf("value%d", i))
+	}
+	rate = b.FalsePositiveRate()
+	if math.Abs(rate-0.01) > 0.002 {
+		t.Errorf("b.FalsePositiveRate() = %v, want approximately %v", rate, 0.01)
+	}
+
+	for i := 1000; i < 10000; i++ {
+		b.AddString(fmt.Sprintf("value%d", i))
+	}
+	rate = b.FalsePositiveRate()
+	if rate < 0.5 {
+		t.Errorf("b.FalsePositiveRate() of overfull filter = %v, want at least %v", rate, 0.5)
+	}
+}
+
+func TestStats(t *testing.T) {
+	b := New(1000, 0.01)
+	for i := 0; i < 500; i++ {
+		b.AddString(fmt.Sprintf("value%d", i))
+	}
+
+	got := b.Stats()
+	want := Stats{
+		M:                          b.M(),
+		K:                          b.K(),
+		SetBits:                    b.PopCount(),
+		FillRatio:                  b.FillRatio(),
+		EstimatedCount:             b.EstimateCount(),
+		EstimatedFalsePositiveRate: b.FalsePositiveRate(),
+	}
+	if got != want {
+		t.Errorf("b.Stats() = %+v, want %+v", got, want)
+	}
+}
+
+func TestRemainingCapacity(t *testing.T) {
+	b := New(1000, 0.01)
+
+	remaining := b.RemainingCapacity(0.01)
+	if remaining < 950 || remaining > 1050 {
+		t.Errorf("b.RemainingCapacity(0.01) of empty filter = %v, want approximately %v", remaining, 1000)
+	}
+
+	for i := 0; i < 400; i++ {
+		b.AddString(fmt.Sprintf("value%d", i))
+	}
+	remaining = b.RemainingCapacity(0.01)
+	if remaining < 550 || remaining > 650 {
+		t.Errorf("b.RemainingCapacity(0.01) = %v, want approximately %v", remaining, 600)
+	}
+
+	for i := 400; i < remaining+400; i++ {
+		b.AddString(fmt.Sprintf("value%d", i))
+	}
+	rate := b.FalsePositiveRate()
+	if math.Abs(rate-0.01) > 0.002 {
+		t.Errorf("b.FalsePositiveRate() after adding the remaining capacity = %v, want approximately %v", rate, 0.01)
+	}
+
+	for i := 0; i < 1000; i++ {
+		b.AddString(fmt.Sprintf("other%d", i))
+	}
+	remaining = b.RemainingCapacity(0.01)
+	if remaining != 0 {
+		t.Errorf("b.RemainingCapacity(0.01) of overfull filter = %v, want %v", remaining, 0)
+	}
+}
+
+func TestRecommend(t *testing.T) {
+	b := New(100, 0.01)
+	for i := 0; i < 1000; i++ {
+		b.AddString(fmt.Sprintf("value%d", i))
+	}
+
+	// The filter is overfull, so the estimate is less accurate
+	m, k := b.Recommend(0.01)
+	wantM, wantK := CalcOptimalMK(1000, 0.01)
+	if math.Abs(float64(m-wantM))/float64(wantM) > 0.2 || k != wantK {
+		t.Errorf("b.Recommend(0.01) = %v, %v, want approximately %v, %v", m, k, wantM, wantK)
+	}
+
+	m, k = New(100, 0.01).Recommend(0.01)
+	wantM, wantK = CalcOptimalMK(1, 0.01)
+	if m != wantM || k != wantK {
+		t.Errorf("b.Recommend(0.01) of empty filter = %v, %v, want %v, %v", m, k, wantM, wantK)
+	}
+}
+
+func TestDumpBits(t *testing.T) {
+	b := NewMK(70, 1)
+	for _, index := range []int{0, 3, 63, 64, 69} {
+		b.SetBit(index)
+	}
+
+	var buf bytes.Buffer
+	err := b.DumpBits(&buf)
+	if err != nil {
+		t.Fatalf("b.DumpBits() returned error: %v", err)
+	}
+	want := "1001" + strings.Repeat("0", 59) + "1\n" + "100001\n"
+	if buf.String() != want {
+		t.Errorf("b.DumpBits() wrote %q, want %q", buf.String(), want)
+	}
+
+	buf.Reset()
+	err = NewMK(maxDumpBits+1, 1).DumpBits(&buf)
+	if err == nil {
+		t.Errorf("b.DumpBits() of %d bits = nil, want error", maxDumpBits+1)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("b.DumpBits() of %d bits wrote %d bytes, want %d", maxDumpBits+1, buf.Len(), 0)
+	}
+
+	err = NewMK(maxDumpBits, 1).DumpBits(&buf)
+	if err != nil {
+		t.Errorf("b.DumpBits() of %d bits returned error: %v", maxDumpBits, err)
+	}
+	if buf.Len() != maxDumpBits+maxDumpBits/dumpColumns {
+		t.Errorf("b.DumpBits() of %d bits wrote %d bytes, want %d", maxDumpBits, buf.Len(), maxDumpBits+maxDumpBits/dumpColumns)
+	}
+}
+
+func TestMeasureFalsePositiveRate(t *testing.T) {
+	b := New(1000, 0.01)
+	for i := 0; i < 1000; i++ {
+		b.AddString(fmt.Sprintf("value%d", i))
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	got := MeasureFalsePositiveRate(b, 100000, rng)
+	want := b.FalsePositiveRate()
+	if math.Abs(got-want)/want > 0.2 {
+		t.Errorf("MeasureFalsePositiveRate(b, 100000) = %v, want %v +/- 20%%", got, want)
+	}
+
+	got = MeasureFalsePositiveRate(New(1000, 0.01), 1000, rng)
+	if got != 0 {
+		t.Errorf("MeasureFalsePositiveRate() of empty filter = %v, want %v", got, 0)
+	}
+	got = MeasureFalsePositiveRate(b, 0, rng)
+	if got != 0 {
+		t.Errorf("MeasureFalsePositiveRate(b, 0) = %v, want %v", got, 0)
+	}
+}
+
+func TestIsEmptyIsSaturated(t *testing.T) {
+	b := NewMK(100, 3)
+	if !b.IsEmpty() || b.IsSaturated() {
+		t.Errorf("new filter IsEmpty(), IsSaturated() = %v, %v, want %v, %v", b.IsEmpty(), b.IsSaturated(), true, false)
+	}
+
+	b.AddString("SomeValue")
+	if b.IsEmpty() || b.IsSaturated() {
+		t.Errorf("filter with one value IsEmpty(), IsSaturated() = %v, %v, want %v, %v", b.IsEmpty(), b.IsSaturated(), false, false)
+	}
+
+	for i := 0; i < 100; i++ {
+		b.SetBit(i)
+	}
+	if b.IsEmpty() || !b.IsSaturated() {
+		t.Errorf("full filter IsEmpty(), IsSaturated() = %v, %v, want %v, %v", b.IsEmpty(), b.IsSaturated(), false, true)
+	}
+
+	b.Clear()
+	if !b.IsEmpty() || b.IsSaturated() {
+		t.Errorf("cleared filter IsEmpty(), IsSaturated() = %v, %v, want %v, %v", b.IsEmpty(), b.IsSaturated(), true, false)
+	}
+}
+
+func TestMemoryBytes(t *testing.T) {
+	overhead := int(unsafe.Sizeof(BloomFilter{}))
+	for _, tt := range []struct {
+		m    int
+		want int
+	}{
+		{0, overhead + 8},
+		{1, overhead + 8},
+		{64, overhead + 8},
+		{65, overhead + 16},
+		{2075673, overhead + 259464},
+	} {
+		got := EstimateMemoryBytes(tt.m)
+		if got != tt.want {
+			t.Errorf("EstimateMemoryBytes(%v) = %v, want %v", tt.m, got, tt.want)
+		}
+
+		got = NewMK(tt.m, 3).MemoryBytes()
+		if got != tt.want {
+			t.Errorf("NewMK(%v, 3).MemoryBytes() = %v, want %v", tt.m, got, tt.want)
+		}
+	}
+}